@@ -2,17 +2,35 @@ package command
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/logger"
 	"ezreal.com.cn/pip/pip/agent"
 	_ "ezreal.com.cn/pip/pip/all"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
 	// Used for flags.
-	pipCfgFile string
+	pipCfgFile              string
+	fConfigs                []string
+	fConfigDirectory        string
+	fConfigURLWatchInterval time.Duration
+	fWatchConfig            bool
+	fStrict                 bool
+	fDebug                  bool
+	fQuiet                  bool
+	fInputFilters           string
+	fOutputFilters          string
+	fProcessorFilters       string
+	fAggregatorFilters      string
 )
 
 // NewPipCmd ...
@@ -24,47 +42,236 @@ func NewPipCmd() *cobra.Command {
 		Run:   runPip,
 	}
 
-	pipCmd.PersistentFlags().StringVar(&pipCfgFile, "pipCfgFile", "./pip.toml", "config file (default is $HOME/pip.toml)")
+	pipCmd.PersistentFlags().StringVar(&pipCfgFile, "pipCfgFile", "", "config file")
+	pipCmd.PersistentFlags().MarkDeprecated("pipCfgFile", "use --config instead")
+	pipCmd.PersistentFlags().StringArrayVar(&fConfigs, "config", nil,
+		"config file or http(s) URL to load, may be repeated (default searches $PIP_CONFIG_PATH, ./pip_config.toml, ~/.pip/pip.toml and /etc/pip/pip.toml)")
+	pipCmd.PersistentFlags().DurationVar(&fConfigURLWatchInterval, "config-url-watch-interval", 0,
+		"interval at which remote http(s) configs are polled for changes, 0 disables polling")
+	pipCmd.PersistentFlags().BoolVar(&fWatchConfig, "watch-config", false, "reload the config when a local config file changes")
+	pipCmd.PersistentFlags().StringVar(&fConfigDirectory, "config-directory", "", "directory containing additional *.toml, *.yaml, *.yml and *.json config files")
+	pipCmd.PersistentFlags().BoolVar(&fStrict, "strict", false, "report unknown keys and missing required plugin settings as errors")
+	pipCmd.PersistentFlags().BoolVar(&fDebug, "debug", false, "turn on debug logging")
+	pipCmd.PersistentFlags().BoolVar(&fQuiet, "quiet", false, "run in quiet mode, only errors are logged")
+	pipCmd.PersistentFlags().StringVar(&fInputFilters, "input-filter", "", "filter the inputs to enable, separator is :")
+	pipCmd.PersistentFlags().StringVar(&fOutputFilters, "output-filter", "", "filter the outputs to enable, separator is :")
+	pipCmd.PersistentFlags().StringVar(&fProcessorFilters, "processor-filter", "", "filter the processors to enable, separator is :")
+	pipCmd.PersistentFlags().StringVar(&fAggregatorFilters, "aggregator-filter", "", "filter the aggregators to enable, separator is :")
+
+	pipCmd.AddCommand(newConfigCmd())
+	pipCmd.AddCommand(newPluginsCmd())
+	pipCmd.AddCommand(newSecretsCmd())
 
-	// Use config file from the flag.
-	viper.SetConfigFile(pipCfgFile)
 	return pipCmd
 }
 
 func runPip(cmd *cobra.Command, args []string) {
-
-	inputFilters := []string{"HTTP_WZXY_FETCH_PASSERS"}
-	outputFilters := []string{"HTTP_WZXY_SAVE_PASSERS"}
-	processorFilters := []string{"HTTP_WZXY_FACE_COMPARE"}
-
 	run(
-		inputFilters,
-		outputFilters,
-		processorFilters,
+		splitFilter(fInputFilters),
+		splitFilter(fOutputFilters),
+		splitFilter(fProcessorFilters),
+		splitFilter(fAggregatorFilters),
 	)
 }
 
-func run(inputFilters, outputFilters, processorFilters []string) {
-	ctx, _ := context.WithCancel(context.Background())
-	runAgent(
-		ctx,
-		inputFilters,
-		outputFilters,
-		processorFilters,
-	)
+// splitFilter splits a colon separated list of plugin names.
+func splitFilter(filter string) []string {
+	var names []string
+	for _, name := range strings.Split(filter, ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
-func runAgent(ctx context.Context,
+func run(inputFilters, outputFilters, processorFilters, aggregatorFilters []string) {
+	err := logger.SetupLogging(logger.LogConfig{
+		Debug: fDebug,
+		Quiet: fQuiet,
+	})
+	if err != nil {
+		log.Fatalf("E! [pip] Error setting up logging: %v", err)
+	}
+
+	load := func() (*config.Config, error) {
+		return loadConfig(
+			inputFilters,
+			outputFilters,
+			processorFilters,
+			aggregatorFilters,
+		)
+	}
+
+	c, err := load()
+	if err != nil {
+		log.Fatalf("E! [pip] Error running agent: %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func(c *config.Config) {
+			done <- runAgent(ctx, c)
+		}(c)
+
+		changed := make(chan struct{}, 1)
+		watchConfig(ctx, c, changed)
+
+		// Wait for a valid config to reload, the running pipeline is only
+		// stopped once its replacement could be loaded.
+		var next *config.Config
+		for next == nil {
+			select {
+			case sig := <-signals:
+				if sig != syscall.SIGHUP {
+					log.Printf("I! Received signal %s, stopping", sig)
+					cancel()
+					if err := <-done; err != nil && err != context.Canceled {
+						log.Fatalf("E! [pip] Error running agent: %v", err)
+					}
+					return
+				}
+				log.Printf("I! Received signal %s, reloading pip config", sig)
+			case <-changed:
+				log.Printf("I! Config changed, reloading pip config")
+			case err := <-done:
+				cancel()
+				if err != nil && err != context.Canceled {
+					log.Fatalf("E! [pip] Error running agent: %v", err)
+				}
+				return
+			}
+
+			next = reloadConfig(load)
+		}
+
+		cancel()
+		if err := <-done; err != nil && err != context.Canceled {
+			log.Fatalf("E! [pip] Error running agent: %v", err)
+		}
+		c = next
+	}
+}
+
+// reloadConfig loads and checks the config replacing the running one, it
+// returns nil when the running pipeline must be kept.
+func reloadConfig(load func() (*config.Config, error)) *config.Config {
+	c, err := load()
+	if err == nil {
+		err = checkConfig(c)
+	}
+	if err != nil {
+		log.Printf("E! [pip] Error reloading config, keeping the running pipeline: %v", err)
+		return nil
+	}
+	return c
+}
+
+// checkConfig initializes the plugins of a reloaded config and checks its
+// outputs can connect, while the running pipeline keeps going.  The outputs
+// stay connected and are used as is when the config is run.
+func checkConfig(c *config.Config) error {
+	if err := c.InitPlugins(); err != nil {
+		return err
+	}
+	ag, err := agent.NewAgent(c)
+	if err != nil {
+		return err
+	}
+	return ag.CheckOutputs()
+}
+
+// watchConfig starts the watchers enabled on the command line, they signal
+// changed until ctx is done.
+func watchConfig(ctx context.Context, c *config.Config, changed chan<- struct{}) {
+	if fConfigURLWatchInterval > 0 {
+		go c.WatchRemote(ctx, fConfigURLWatchInterval, changed)
+	}
+	if fWatchConfig {
+		go func() {
+			if err := c.WatchFiles(ctx, changed); err != nil {
+				log.Printf("E! [pip] Error watching config files: %v", err)
+			}
+		}()
+	}
+}
+
+// loadConfig builds and validates the Config from the config flags.
+func loadConfig(
 	inputFilters []string,
 	outputFilters []string,
 	processorFilters []string,
-) error {
+	aggregatorFilters []string,
+) (*config.Config, error) {
 	c := config.NewConfig()
 	c.InputFilters = inputFilters
 	c.OutputFilters = outputFilters
-	//c.ProcessorsFilters = processorFilters
+	c.ProcessorFilters = processorFilters
+	c.AggregatorFilters = aggregatorFilters
+	c.Strict = fStrict
+
+	if err := loadConfigFiles(c); err != nil {
+		return nil, err
+	}
 
-	c.LoadConfig("./pip_config.toml")
+	for _, p := range c.AllPipelines() {
+		where := ""
+		if p.Name != config.DefaultPipeline {
+			where = fmt.Sprintf(" in pipeline %q", p.Name)
+		}
+		if len(p.Outputs) == 0 {
+			return nil, fmt.Errorf("Error: no outputs found%s, did you provide a valid config file?", where)
+		}
+		if len(p.Inputs) == 0 {
+			return nil, fmt.Errorf("Error: no inputs found%s, did you provide a valid config file?", where)
+		}
+	}
+	return c, nil
+}
+
+// loadConfigFiles loads the config files and directory given on the command
+// line into c.
+func loadConfigFiles(c *config.Config) error {
+	configs := fConfigs
+	if pipCfgFile != "" {
+		configs = append([]string{pipCfgFile}, configs...)
+	}
+	if len(configs) == 0 && fConfigDirectory == "" {
+		// search the default locations
+		configs = []string{""}
+	}
+	var errs config.Errors
+	for _, path := range configs {
+		if err := c.LoadConfig(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if fConfigDirectory != "" {
+		if err := c.LoadDirectory(fConfigDirectory); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func runAgent(ctx context.Context, c *config.Config) error {
+	err := logger.SetupLogging(logger.LogConfig{
+		Debug:   fDebug || c.Agent.Debug,
+		Quiet:   fQuiet || c.Agent.Quiet,
+		Level:   c.Agent.LogLevel,
+		Logfile: c.Agent.Logfile,
+	})
+	if err != nil {
+		return err
+	}
 
 	ag, err := agent.NewAgent(c)
 	if err != nil {
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"errors"
+	"testing"
+
+	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/models"
+)
+
+type testInput struct {
+	initErr error
+}
+
+func (i *testInput) Description() string              { return "test input" }
+func (i *testInput) SampleConfig() string             { return "" }
+func (i *testInput) Init() error                      { return i.initErr }
+func (i *testInput) Gather(acc pip.Accumulator) error { return nil }
+
+type testOutput struct {
+	connectErr error
+	connects   int
+	closed     bool
+}
+
+func (o *testOutput) Description() string              { return "test output" }
+func (o *testOutput) SampleConfig() string             { return "" }
+func (o *testOutput) Write(metrics []pip.Metric) error { return nil }
+
+func (o *testOutput) Connect() error {
+	o.connects++
+	return o.connectErr
+}
+
+func (o *testOutput) Close() error {
+	o.closed = true
+	return nil
+}
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		loadErr    error
+		initErr    error
+		connectErr error
+		behavior   string
+		reloaded   bool
+	}{
+		{name: "valid", reloaded: true},
+		{name: "load error", loadErr: errors.New("syntax error")},
+		{name: "init error", initErr: errors.New("bad setting")},
+		{name: "connect error", connectErr: errors.New("connection refused")},
+		{
+			name:       "connect retried in the background",
+			connectErr: errors.New("connection refused"),
+			behavior:   models.StartupErrorRetry,
+			reloaded:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := &testOutput{connectErr: tt.connectErr}
+			load := func() (*config.Config, error) {
+				if tt.loadErr != nil {
+					return nil, tt.loadErr
+				}
+				c := config.NewConfig()
+				c.Inputs = append(c.Inputs, models.NewRunningInput(&testInput{initErr: tt.initErr},
+					&models.InputConfig{Name: "test"}))
+				c.Outputs = append(c.Outputs, models.NewRunningOutput(output, &models.OutputConfig{
+					Name:                 "test",
+					StartupErrorBehavior: tt.behavior,
+				}, 0, 0))
+				return c, nil
+			}
+
+			c := reloadConfig(load)
+			if (c != nil) != tt.reloaded {
+				t.Fatalf("reloadConfig() = %v, want reloaded %v", c, tt.reloaded)
+			}
+			if tt.reloaded && tt.connectErr == nil {
+				// the run uses the outputs of the check, they must be open
+				if output.connects != 1 || output.closed {
+					t.Errorf("output connected %d times and closed %v, want it left connected for the run",
+						output.connects, output.closed)
+				}
+				if !c.Outputs[0].Connected() {
+					t.Error("reloaded output not marked connected")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"ezreal.com.cn/pip/config"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd() *cobra.Command {
+	var sectionFilters string
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "print out full sample configuration to stdout",
+		Long: `Print out a sample configuration built from the registered plugins,
+the --section-filter and --<type>-filter flags select what is printed.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.PrintSampleConfig(
+				splitFilter(sectionFilters),
+				splitFilter(fInputFilters),
+				splitFilter(fOutputFilters),
+				splitFilter(fAggregatorFilters),
+				splitFilter(fProcessorFilters),
+			)
+		},
+	}
+	configCmd.Flags().StringVar(&sectionFilters, "section-filter", "",
+		"filter the sections to print, separator is :. Valid values are 'agent', 'global_tags', 'secretstores', 'outputs', 'processors', 'aggregators', 'inputs' and 'pipelines'")
+
+	configCmd.AddCommand(newConfigValidateCmd())
+	configCmd.AddCommand(newConfigConvertCmd())
+
+	return configCmd
+}
+
+func newConfigValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "check the configuration and report every problem found",
+		Long: `Load the configuration in strict mode and initialize every plugin, unknown
+keys, values of the wrong type, missing required settings and plugin Init
+errors are all reported.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			c := config.NewConfig()
+			c.InputFilters = splitFilter(fInputFilters)
+			c.OutputFilters = splitFilter(fOutputFilters)
+			c.ProcessorFilters = splitFilter(fProcessorFilters)
+			c.AggregatorFilters = splitFilter(fAggregatorFilters)
+			c.Strict = true
+
+			var errs config.Errors
+			if err := loadConfigFiles(c); err != nil {
+				errs = append(errs, err)
+			}
+			if err := c.InitPlugins(); err != nil {
+				errs = append(errs, err)
+			}
+
+			if len(errs) > 0 {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				os.Exit(1)
+			}
+			fmt.Println("Config is valid")
+		},
+	}
+}
+
+func newConfigConvertCmd() *cobra.Command {
+	var from, to string
+
+	convertCmd := &cobra.Command{
+		Use:   "convert <file>",
+		Short: "translate a config file between the TOML, YAML and JSON formats",
+		Long: `Translate a config file to another format and print it to stdout, the
+input format is taken from the file extension unless --from is given.
+Comments are not preserved.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			if from == "" {
+				from = config.FormatOf(args[0])
+			}
+
+			out, err := config.Convert(data, from, to)
+			if err != nil {
+				return fmt.Errorf("converting %s: %w", args[0], err)
+			}
+			_, err = os.Stdout.Write(out)
+			return err
+		},
+	}
+	convertCmd.Flags().StringVar(&from, "from", "",
+		"format of the input file, 'toml', 'yaml' or 'json' (default from the file extension)")
+	convertCmd.Flags().StringVar(&to, "format", config.FormatTOML,
+		"format to convert to, 'toml', 'yaml' or 'json'")
+
+	return convertCmd
+}
+
+func newPluginsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "plugins",
+		Short: "list the registered plugins with their description",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config.PrintPluginDescriptions()
+		},
+	}
+}
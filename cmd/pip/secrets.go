@@ -0,0 +1,89 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/pip"
+	"github.com/spf13/cobra"
+)
+
+func newSecretsCmd() *cobra.Command {
+	secretsCmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "manage the secrets of the configured secret stores",
+	}
+
+	secretsCmd.AddCommand(&cobra.Command{
+		Use:   "list <store-id>",
+		Short: "list the keys of a secret store",
+		Args:  cobra.ExactArgs(1),
+		// errors are about the store, not about the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := loadSecretStore(args[0])
+			if err != nil {
+				return err
+			}
+			keys, err := store.List()
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				fmt.Println(key)
+			}
+			return nil
+		},
+	})
+
+	secretsCmd.AddCommand(&cobra.Command{
+		Use:   "set <store-id> <key> [value]",
+		Short: "store a secret, the value is read from stdin when omitted",
+		Args:  cobra.RangeArgs(2, 3),
+		// errors are about the store, not about the usage
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := loadSecretStore(args[0])
+			if err != nil {
+				return err
+			}
+
+			var value string
+			if len(args) == 3 {
+				value = args[2]
+			} else {
+				value, err = bufio.NewReader(os.Stdin).ReadString('\n')
+				if err != nil && value == "" {
+					return fmt.Errorf("reading secret from stdin: %w", err)
+				}
+				value = strings.TrimRight(value, "\r\n")
+			}
+			return store.Set(args[1], value)
+		},
+	})
+
+	return secretsCmd
+}
+
+// loadSecretStore loads the config and returns the secret store with the id.
+func loadSecretStore(id string) (pip.SecretStore, error) {
+	c := config.NewConfig()
+	// Only the secret stores are needed, filter out every plugin as they
+	// may reference secrets that are not set yet.
+	none := []string{""}
+	c.InputFilters = none
+	c.OutputFilters = none
+	c.ProcessorFilters = none
+	c.AggregatorFilters = none
+	if err := loadConfigFiles(c); err != nil {
+		return nil, err
+	}
+	store, ok := c.SecretStores[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown secret store %q", id)
+	}
+	return store, nil
+}
@@ -23,6 +23,7 @@ var (
 // Execute executes the root command.
 func Execute() error {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "cfgFile", "./maya.toml", "config file (default is $HOME/maya.toml)")
+	rootCmd.PersistentFlags().MarkDeprecated("cfgFile", "use --config instead")
 
 	// Use config file from the flag.
 	viper.SetConfigFile(cfgFile)
@@ -2,115 +2,535 @@ package config
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"regexp"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"ezreal.com.cn/pip/internal"
+	"ezreal.com.cn/pip/logger"
 	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/aggregators"
 	"ezreal.com.cn/pip/pip/input"
 	"ezreal.com.cn/pip/pip/models"
 	"ezreal.com.cn/pip/pip/output"
 	"ezreal.com.cn/pip/pip/parsers"
 	"ezreal.com.cn/pip/pip/processors"
+	"ezreal.com.cn/pip/pip/secretstores"
+	"ezreal.com.cn/pip/pip/serializers"
 	"github.com/influxdata/toml"
 	"github.com/influxdata/toml/ast"
 )
 
 var (
 	// Default sections
-	sectionDefaults = []string{"global_tags", "agent", "outputs",
-		"processors", "aggregators", "inputs"}
+	sectionDefaults = []string{"global_tags", "agent", "secretstores",
+		"outputs", "processors", "aggregators", "inputs", "pipelines"}
 
 	// Default input plugins
-	inputDefaults = []string{"cpu", "mem", "swap", "system", "kernel",
-		"processes", "disk", "diskio"}
+	inputDefaults = []string{"simple"}
 
 	// Default output plugins
-	outputDefaults = []string{"influxdb"}
-
-	// envVarRe is a regex to find environment variables in the config file
-	envVarRe = regexp.MustCompile(`\$\{(\w+)\}|\$(\w+)`)
+	outputDefaults = []string{"simpleoutput"}
 
 	envVarEscaper = strings.NewReplacer(
+		`\`, `\\`,
 		`"`, `\"`,
 	)
+
+	httpClient = &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	// configTokenEnv names the environment variable holding the bearer
+	// token sent when fetching a remote config.
+	configTokenEnv = "PIP_CONFIG_TOKEN"
+
+	fetchConfigRetries       = 3
+	fetchConfigRetryInterval = 10 * time.Second
 )
 
 // Config specifies the URL/user/password for the database that telegraf
 // will be logging to, as well as all the plugins that the user has
 // specified
 type Config struct {
-	Tags          map[string]string
-	InputFilters  []string
-	OutputFilters []string
-
-	Inputs  []*models.RunningInput
-	Outputs []*models.RunningOutput
-	// Processors have a slice wrapper type because they need to be sorted
-	Processors    models.RunningProcessors
-	AggProcessors models.RunningProcessors
+	Tags map[string]string
+	// Strict reports unknown keys and missing required plugin settings as
+	// errors, unknown keys are only logged otherwise
+	Strict            bool
+	InputFilters      []string
+	OutputFilters     []string
+	ProcessorFilters  []string
+	AggregatorFilters []string
+
+	Agent        *AgentConfig
+	SecretStores map[string]pip.SecretStore
+
+	// Pipeline holds the plugins defined at the root of the config, the
+	// named pipelines of the [pipelines.<name>] tables are in Pipelines.
+	*Pipeline
+	Pipelines map[string]*Pipeline
+
+	// remoteHashes holds the content hash of the remote configs loaded
+	remoteHashes map[string][sha256.Size]byte
+	// localFiles and localDirs are the config files and directories loaded
+	localFiles []string
+	localDirs  []string
+
+	// initOnce runs Init on the plugins once, a reloaded config is
+	// initialized before it replaces the running one.
+	initOnce sync.Once
+	initErr  error
 }
 
 func NewConfig() *Config {
 	c := &Config{
 		// Agent defaults:
-
-		Tags:          make(map[string]string),
-		Inputs:        make([]*models.RunningInput, 0),
-		Outputs:       make([]*models.RunningOutput, 0),
-		Processors:    make([]*models.RunningProcessor, 0),
-		AggProcessors: make([]*models.RunningProcessor, 0),
-		InputFilters:  make([]string, 0),
-		OutputFilters: make([]string, 0),
+		Agent: &AgentConfig{
+			Interval:          internal.Duration{Duration: 10 * time.Second},
+			RoundInterval:     true,
+			FlushInterval:     internal.Duration{Duration: 10 * time.Second},
+			MetricBatchSize:   models.DefaultMetricBatchSize,
+			MetricBufferLimit: models.DefaultMetricBufferLimit,
+
+			OutputConnectRetries:       1,
+			OutputConnectRetryInterval: internal.Duration{Duration: 15 * time.Second},
+			OutputStartupErrorBehavior: models.StartupErrorError,
+
+			BufferStrategy: models.BufferStrategyMemory,
+
+			ChannelCapacity: 100,
+			OverflowPolicy:  models.OverflowBlock,
+		},
+
+		Tags:              make(map[string]string),
+		SecretStores:      make(map[string]pip.SecretStore),
+		Pipeline:          newPipeline(DefaultPipeline),
+		Pipelines:         make(map[string]*Pipeline),
+		InputFilters:      make([]string, 0),
+		OutputFilters:     make([]string, 0),
+		ProcessorFilters:  make([]string, 0),
+		AggregatorFilters: make([]string, 0),
+		remoteHashes:      make(map[string][sha256.Size]byte),
 	}
 	return c
 }
 
-// LoadConfig loads the given config file and applies it to c
+// AgentConfig defines configuration that will be used by the agent
+type AgentConfig struct {
+	// Interval at which to gather information
+	Interval internal.Duration `toml:"interval"`
+
+	// RoundInterval rounds collection interval to 'interval'.
+	//     ie, if Interval=10s then always collect on :00, :10, :20, etc.
+	RoundInterval bool `toml:"round_interval"`
+
+	// CollectionJitter is used to jitter the collection by a random amount.
+	// Each plugin will sleep for a random time within jitter before collecting.
+	// This can be used to avoid many plugins querying things like sysfs at the
+	// same time, which can have a measurable effect on the system.
+	CollectionJitter internal.Duration `toml:"collection_jitter"`
+
+	// Precision rounds the timestamps of gathered metrics, when unset it is
+	// derived from the collection interval.
+	//     ie, if Precision=1s then metrics are rounded to the nearest second.
+	Precision internal.Duration `toml:"precision"`
+
+	// FlushInterval is the Interval at which to flush data
+	FlushInterval internal.Duration `toml:"flush_interval"`
+
+	// FlushJitter Jitters the flush interval by a random amount.
+	// This is primarily to avoid large write spikes for users running a large
+	// number of pip instances.
+	// ie, a jitter of 5s and interval 10s means flushes will happen every 10-15s
+	FlushJitter internal.Duration `toml:"flush_jitter"`
+
+	// MetricBatchSize is the maximum number of metrics that is wrote to an
+	// output plugin in one call.
+	MetricBatchSize int `toml:"metric_batch_size"`
+
+	// MetricBufferLimit is the max number of metrics that each output plugin
+	// will cache. The buffer is cleared when a successful write occurs. When
+	// full, the oldest metrics will be overwritten. This number should be a
+	// multiple of MetricBatchSize. Due to current implementation, this could
+	// not be less than 2 times MetricBatchSize.
+	MetricBufferLimit int `toml:"metric_buffer_limit"`
+
+	// Hostname is set as the "host" tag on every metric, it defaults to the
+	// name returned by os.Hostname.
+	Hostname     string `toml:"hostname"`
+	OmitHostname bool   `toml:"omit_hostname"`
+
+	// Debug is the option for running in debug mode
+	Debug bool `toml:"debug"`
+
+	// Quiet is the option for running in quiet mode
+	Quiet bool `toml:"quiet"`
+
+	// LogLevel is one of "debug", "info", "warn" or "error"
+	LogLevel string `toml:"log_level"`
+
+	// Logfile is the file the log is written to, stderr when empty
+	Logfile string `toml:"logfile"`
+
+	// OutputConnectRetries is the number of times Connect is retried at
+	// startup before giving up on an output.
+	OutputConnectRetries int `toml:"output_connect_retries"`
+
+	// OutputConnectRetryInterval is the wait before the first Connect retry,
+	// it doubles after each failed attempt.
+	OutputConnectRetryInterval internal.Duration `toml:"output_connect_retry_interval"`
+
+	// OutputStartupErrorBehavior is either "error" to fail startup once the
+	// retries are exhausted, or "retry" to start anyway and keep connecting
+	// in the background.
+	OutputStartupErrorBehavior string `toml:"output_startup_error_behavior"`
+
+	// BufferStrategy is the default buffer of the outputs, "memory" or
+	// "disk".  A disk buffer keeps the metrics in a write-ahead log under
+	// BufferDirectory, one sub-directory per output, so they survive output
+	// outages and restarts.
+	BufferStrategy  string `toml:"buffer_strategy"`
+	BufferDirectory string `toml:"buffer_directory"`
+
+	// BufferMaxSize is the disk space each disk buffer may use, the oldest
+	// metrics are dropped once it is exceeded.  Zero means no limit.
+	BufferMaxSize internal.Size `toml:"buffer_max_size"`
+
+	// ChannelCapacity and OverflowPolicy are the defaults of the channels
+	// feeding the processors, aggregators and outputs.  The policy is one of
+	// "block", "drop-newest", "drop-oldest" or "spill-to-disk", spilled
+	// metrics are kept under BufferDirectory.
+	ChannelCapacity int    `toml:"channel_capacity"`
+	OverflowPolicy  string `toml:"overflow_policy"`
+
+	// Channels overrides the channel settings of a stage, keyed by
+	// "processors", "aggregators" or "outputs".  The "outputs" settings also
+	// apply to the queue feeding each output.
+	Channels map[string]ChannelConfig `toml:"channels"`
+}
+
+// ChannelConfig overrides the channel settings of a pipeline stage.
+type ChannelConfig struct {
+	Capacity       int    `toml:"capacity"`
+	OverflowPolicy string `toml:"overflow_policy"`
+}
+
+// Pipeline stages fed by a channel.
+var channelStages = []string{"processors", "aggregators", "outputs"}
+
+// channel returns the settings of the channel called name, the overrides
+// are applied in order over the agent defaults.
+func (a *AgentConfig) channel(name string, overrides ...ChannelConfig) *models.ChannelConfig {
+	cc := &models.ChannelConfig{
+		Name:           name,
+		Capacity:       a.ChannelCapacity,
+		OverflowPolicy: a.OverflowPolicy,
+	}
+	for _, override := range overrides {
+		if override.Capacity != 0 {
+			cc.Capacity = override.Capacity
+		}
+		if override.OverflowPolicy != "" {
+			cc.OverflowPolicy = override.OverflowPolicy
+		}
+	}
+	if cc.OverflowPolicy == models.OverflowSpill {
+		cc.SpillDirectory = filepath.Join(a.BufferDirectory, "channels", name)
+		cc.SpillMaxSize = a.BufferMaxSize.Size
+	}
+	return cc
+}
+
+// validate checks the settings read from the agent table, errors name the
+// offending key and the line it was set on.
+func (a *AgentConfig) validate(tbl *ast.Table) error {
+	keyErr := func(key string, format string, args ...interface{}) error {
+		msg := fmt.Sprintf(format, args...)
+		if kv, ok := tbl.Fields[key].(*ast.KeyValue); ok {
+			return fmt.Errorf("agent.%s (line %d): %s", key, kv.Line, msg)
+		}
+		return fmt.Errorf("agent.%s: %s", key, msg)
+	}
+
+	if a.Interval.Duration <= 0 {
+		return keyErr("interval", "must be positive, got %s", a.Interval.Duration)
+	}
+	if a.FlushInterval.Duration <= 0 {
+		return keyErr("flush_interval", "must be positive, got %s", a.FlushInterval.Duration)
+	}
+	if a.CollectionJitter.Duration < 0 {
+		return keyErr("collection_jitter", "must not be negative, got %s", a.CollectionJitter.Duration)
+	}
+	if a.FlushJitter.Duration < 0 {
+		return keyErr("flush_jitter", "must not be negative, got %s", a.FlushJitter.Duration)
+	}
+	if a.Precision.Duration < 0 {
+		return keyErr("precision", "must not be negative, got %s", a.Precision.Duration)
+	}
+	if a.MetricBatchSize <= 0 {
+		return keyErr("metric_batch_size", "must be positive, got %d", a.MetricBatchSize)
+	}
+	if a.MetricBufferLimit < a.MetricBatchSize {
+		return keyErr("metric_buffer_limit", "must not be less than metric_batch_size (%d), got %d",
+			a.MetricBatchSize, a.MetricBufferLimit)
+	}
+	if _, err := logger.ParseLevel(a.LogLevel); err != nil {
+		return keyErr("log_level", "%s", err)
+	}
+	if a.OutputConnectRetryInterval.Duration < 0 {
+		return keyErr("output_connect_retry_interval", "must not be negative, got %s",
+			a.OutputConnectRetryInterval.Duration)
+	}
+	switch a.OutputStartupErrorBehavior {
+	case models.StartupErrorError, models.StartupErrorRetry:
+	default:
+		return keyErr("output_startup_error_behavior", "must be %q or %q, got %q",
+			models.StartupErrorError, models.StartupErrorRetry, a.OutputStartupErrorBehavior)
+	}
+	if err := checkBufferStrategy(a.BufferStrategy); err != nil {
+		return keyErr("buffer_strategy", "%s", err)
+	}
+	if a.BufferStrategy == models.BufferStrategyDisk && a.BufferDirectory == "" {
+		return keyErr("buffer_directory", "must be set with the %q buffer strategy", models.BufferStrategyDisk)
+	}
+	if a.BufferMaxSize.Size < 0 {
+		return keyErr("buffer_max_size", "must not be negative, got %d", a.BufferMaxSize.Size)
+	}
+	if err := a.checkChannel(a.ChannelCapacity, a.OverflowPolicy); err != nil {
+		return keyErr("overflow_policy", "%s", err)
+	}
+	stages := make([]string, 0, len(a.Channels))
+	for stage := range a.Channels {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		if !sliceContains(stage, channelStages) {
+			return keyErr("channels", "unknown stage %q, must be one of %s",
+				stage, strings.Join(channelStages, ", "))
+		}
+		cc := a.channel(stage, a.Channels[stage])
+		if err := a.checkChannel(cc.Capacity, cc.OverflowPolicy); err != nil {
+			return keyErr("channels", "%s: %s", stage, err)
+		}
+	}
+	return nil
+}
+
+// checkChannel returns an error for invalid channel settings.
+func (a *AgentConfig) checkChannel(capacity int, policy string) error {
+	switch policy {
+	case models.OverflowBlock:
+		if capacity < 0 {
+			return fmt.Errorf("capacity must not be negative, got %d", capacity)
+		}
+		return nil
+	case models.OverflowDropNewest, models.OverflowDropOldest, models.OverflowSpill:
+	default:
+		return fmt.Errorf("must be %q, %q, %q or %q, got %q", models.OverflowBlock,
+			models.OverflowDropNewest, models.OverflowDropOldest, models.OverflowSpill, policy)
+	}
+
+	if capacity <= 0 {
+		return fmt.Errorf("capacity must be positive with the %q policy, got %d", policy, capacity)
+	}
+	if policy == models.OverflowSpill && a.BufferDirectory == "" {
+		return fmt.Errorf("the %q policy requires buffer_directory", policy)
+	}
+	return nil
+}
+
+// checkBufferStrategy returns an error for unknown output buffer strategies.
+func checkBufferStrategy(strategy string) error {
+	switch strategy {
+	case models.BufferStrategyMemory, models.BufferStrategyDisk:
+		return nil
+	}
+	return fmt.Errorf("must be %q or %q, got %q",
+		models.BufferStrategyMemory, models.BufferStrategyDisk, strategy)
+}
+
+// getDefaultConfigPath returns the first existing file of $PIP_CONFIG_PATH,
+// ./pip_config.toml, ~/.pip/pip.toml and /etc/pip/pip.toml.
+func getDefaultConfigPath() (string, error) {
+	envfile := os.Getenv("PIP_CONFIG_PATH")
+	localfile := "./pip_config.toml"
+	homefile := os.ExpandEnv("${HOME}/.pip/pip.toml")
+	etcfile := "/etc/pip/pip.toml"
+	if _, ok := configURL(envfile); ok {
+		log.Printf("I! Using config url: %s", envfile)
+		return envfile, nil
+	}
+	for _, path := range []string{envfile, localfile, homefile, etcfile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("I! Using config file: %s", path)
+			return path, nil
+		}
+	}
+
+	// if we got here, we didn't find a file in a default location
+	return "", fmt.Errorf("No config file specified, and could not find one"+
+		" in $PIP_CONFIG_PATH, %s, %s, or %s", localfile, homefile, etcfile)
+}
+
+// LoadDirectory loads every TOML, YAML and JSON file of the directory, in
+// lexical order, and merges them into c.
+func (c *Config) LoadDirectory(path string) error {
+	walkfn := func(thispath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Error walking config directory %s: %w", path, err)
+		}
+
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), "..") {
+				// skip Kubernetes mounts, preventing loading the same config twice
+				return filepath.SkipDir
+			}
+
+			c.localDirs = append(c.localDirs, filepath.Clean(thispath))
+			return nil
+		}
+		if !isConfigFile(info.Name()) {
+			return nil
+		}
+		return c.LoadConfig(thispath)
+	}
+	return filepath.Walk(path, walkfn)
+}
+
+// LoadConfig loads the given config file and applies it to c, an empty path
+// loads the first config file found in the default locations. YAML and JSON
+// files are converted to TOML first.
 func (c *Config) LoadConfig(path string) error {
 	var err error
+	if path == "" {
+		if path, err = getDefaultConfigPath(); err != nil {
+			return err
+		}
+	}
 	data, err := loadConfig(path)
 	if err != nil {
 		return fmt.Errorf("Error loading config file %s: %w", path, err)
 	}
-
-	outor, ok := output.Outputs["simpleoutput"]
-	if !ok {
-		//TODO
+	if _, ok := configURL(path); ok {
+		c.remoteHashes[path] = sha256.Sum256(data)
+	} else {
+		c.localFiles = append(c.localFiles, filepath.Clean(path))
 	}
-	out := outor()
-	c.addOutput(out)
 
-	printer, ok := processors.Processors["printer"]
-	if !ok {
-		//TODO
+	if format := FormatOf(path); format != FormatTOML {
+		if data, err = Convert(data, format, FormatTOML); err != nil {
+			return fmt.Errorf("Error loading config file %s: %w", path, err)
+		}
+		if err = c.LoadConfigData(data); err != nil {
+			return fmt.Errorf("Error loading config file %s (lines refer to the output of 'pip config convert'): %w",
+				path, err)
+		}
+	} else if err = c.LoadConfigData(data); err != nil {
+		return fmt.Errorf("Error loading config file %s: %w", path, err)
 	}
-	print := printer()
-	c.addProcessor(print)
 
-	if err = c.LoadConfigData(data); err != nil {
-		return fmt.Errorf("Error loading config file %s: %w", path, err)
+	if !c.Agent.OmitHostname {
+		if c.Agent.Hostname == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return err
+			}
+
+			c.Agent.Hostname = hostname
+		}
+
+		c.Tags["host"] = c.Agent.Hostname
 	}
 	return nil
 }
-func (c *Config) addOutput(output pip.Output) error {
-	rp := models.NewRunningOutput(output)
-	c.Outputs = append(c.Outputs, rp)
-	return nil
+
+func loadConfig(config string) ([]byte, error) {
+	if u, ok := configURL(config); ok {
+		return fetchConfig(context.Background(), u)
+	}
+
+	// If it isn't a https scheme, try it as a file.
+	return ioutil.ReadFile(config)
 }
 
-func (c *Config) addProcessor(processor pip.StreamingProcessor) error {
-	rp := models.NewRunningProcessor(processor)
-	c.Processors = append(c.Processors, rp)
-	return nil
+// configURL returns the parsed URL when config names a http(s) endpoint.
+func configURL(config string) (*url.URL, bool) {
+	u, err := url.Parse(config)
+	if err != nil {
+		return nil, false
+	}
+	switch u.Scheme {
+	case "https", "http":
+		return u, true
+	default:
+		return nil, false
+	}
 }
 
-func loadConfig(config string) ([]byte, error) {
-	return ioutil.ReadFile(config)
+// fetchConfig gets the config from the remote endpoint, transient failures
+// are retried fetchConfigRetries times until ctx is done.
+func fetchConfig(ctx context.Context, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, exists := os.LookupEnv(configTokenEnv); exists {
+		req.Header.Add("Authorization", "Bearer "+v)
+	}
+	req.Header.Add("Accept", "application/toml")
 
+	for i := 0; ; i++ {
+		body, retry, err := doFetchConfig(req)
+		if err == nil {
+			return body, nil
+		}
+		if !retry || i >= fetchConfigRetries {
+			return nil, fmt.Errorf("failed to retrieve remote config %s after %d retries: %w",
+				u, i, err)
+		}
+		log.Printf("W! Error getting HTTP config %s, retry %d of %d in %s: %s",
+			u, i+1, fetchConfigRetries, fetchConfigRetryInterval, err)
+		if err := internal.SleepContext(ctx, fetchConfigRetryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// doFetchConfig makes a single request, retry reports whether the failure is
+// transient.
+func doFetchConfig(req *http.Request) (body []byte, retry bool, err error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return body, false, nil
 }
 
 // LoadConfigData loads TOML-formatted config data
@@ -120,10 +540,11 @@ func (c *Config) LoadConfigData(data []byte) error {
 		return fmt.Errorf("Error parsing data: %s", err)
 	}
 
+	var errs Errors
+
 	// Parse tags tables first:
 	for _, tableName := range []string{"tags", "global_tags"} {
 		if val, ok := tbl.Fields[tableName]; ok {
-			fmt.Println("val", val)
 			subTable, ok := val.(*ast.Table)
 			if !ok {
 				return fmt.Errorf("invalid configuration, bad table name %q", tableName)
@@ -134,56 +555,408 @@ func (c *Config) LoadConfigData(data []byte) error {
 		}
 	}
 
-	// Parse all the rest of the plugins:
-	for name, val := range tbl.Fields {
+	// Parse agent table:
+	if val, ok := tbl.Fields["agent"]; ok {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid configuration, error parsing agent table")
+		}
+		if err = c.unmarshalTable(subTable, c.Agent); err != nil {
+			errs.add("Error parsing agent", err)
+		} else if err = c.Agent.validate(subTable); err != nil {
+			errs.add("", err)
+		}
+	}
+
+	// Parse secret stores before the plugins referencing them:
+	if val, ok := tbl.Fields["secretstores"]; ok {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid configuration, error parsing secretstores table")
+		}
+		for _, pluginName := range sortedKeys(subTable.Fields) {
+			pluginVal := subTable.Fields[pluginName]
+			switch pluginSubTable := pluginVal.(type) {
+			case []*ast.Table:
+				for _, t := range pluginSubTable {
+					if err = c.addSecretStore(pluginName, t); err != nil {
+						errs.add("Error parsing "+pluginName, err)
+					}
+				}
+			default:
+				errs.add("", fmt.Errorf("Unsupported config format: %s",
+					pluginName))
+			}
+		}
+	}
+
+	// Parse all the rest of the plugins, in name order so that loading is
+	// deterministic:
+	for _, name := range sortedKeys(tbl.Fields) {
+		val := tbl.Fields[name]
 		subTable, ok := val.(*ast.Table)
 		if !ok {
 			return fmt.Errorf("invalid configuration, error parsing field %q as table", name)
 		}
-		fmt.Println("name", name)
-		fmt.Printf("subTable%+v", subTable)
+
 		switch name {
-		case "inputs", "plugins":
-			for pluginName, pluginVal := range subTable.Fields {
-				switch pluginSubTable := pluginVal.(type) {
-				// legacy [inputs.cpu] support
-				case *ast.Table:
-					fmt.Println("pluginName1", pluginName)
-					fmt.Printf("pluginVal1%+v", pluginVal)
-					if err = c.addInput(pluginName, pluginSubTable); err != nil {
-						return fmt.Errorf("Error parsing %s, %s", pluginName, err)
+		case "agent", "tags", "global_tags", "secretstores":
+		case "pipelines":
+			for _, pipelineName := range sortedKeys(subTable.Fields) {
+				pipelineTable, ok := subTable.Fields[pipelineName].(*ast.Table)
+				if !ok {
+					errs.add("", fmt.Errorf("invalid configuration, pipeline %q must be a table",
+						pipelineName))
+					continue
+				}
+				errs.add("pipelines."+pipelineName, c.loadPipeline(pipelineName, pipelineTable))
+			}
+		default:
+			errs.add("", c.addSection(c.Pipeline, name, subTable))
+		}
+	}
+
+	for _, p := range c.AllPipelines() {
+		if len(p.Processors) > 1 {
+			sort.Stable(p.Processors)
+		}
+		if len(p.AggProcessors) > 1 {
+			sort.Stable(p.AggProcessors)
+		}
+	}
+
+	return errs.err()
+}
+
+// addSection adds the plugins of a root section of the config, such as
+// [inputs] or [outputs], to the pipeline.
+func (c *Config) addSection(p *Pipeline, name string, subTable *ast.Table) error {
+	var errs Errors
+	switch name {
+	case "outputs":
+		for _, pluginName := range sortedKeys(subTable.Fields) {
+			pluginVal := subTable.Fields[pluginName]
+			switch pluginSubTable := pluginVal.(type) {
+			// legacy [outputs.influxdb] support
+			case *ast.Table:
+				if err := c.addOutput(p, pluginName, pluginSubTable); err != nil {
+					errs.add("Error parsing "+pluginName, err)
+				}
+			case []*ast.Table:
+				for _, t := range pluginSubTable {
+					if err := c.addOutput(p, pluginName, t); err != nil {
+						errs.add("Error parsing "+pluginName+" array", err)
 					}
-				case []*ast.Table:
-					fmt.Println("pluginName2", pluginName)
-					fmt.Printf("pluginVal2%+v", pluginVal)
-					fmt.Println("----------------------")
-					for _, t := range pluginSubTable {
-						fmt.Printf("pluginVal2-t%+v", t)
-						fmt.Println("----------------------")
-						if err = c.addInput(pluginName, t); err != nil {
-							return fmt.Errorf("Error parsing %s, %s", pluginName, err)
-						}
+				}
+			default:
+				errs.add("", fmt.Errorf("Unsupported config format: %s",
+					pluginName))
+			}
+		}
+	case "inputs", "plugins":
+		for _, pluginName := range sortedKeys(subTable.Fields) {
+			pluginVal := subTable.Fields[pluginName]
+			switch pluginSubTable := pluginVal.(type) {
+			// legacy [inputs.cpu] support
+			case *ast.Table:
+				if err := c.addInput(p, pluginName, pluginSubTable); err != nil {
+					errs.add("Error parsing "+pluginName, err)
+				}
+			case []*ast.Table:
+				for _, t := range pluginSubTable {
+					if err := c.addInput(p, pluginName, t); err != nil {
+						errs.add("Error parsing "+pluginName, err)
 					}
-				default:
-					fmt.Println("pluginName3", pluginName)
-					fmt.Printf("pluginVal3%+v", pluginVal)
-					return fmt.Errorf("Unsupported config format: %s",
-						pluginName)
 				}
+			default:
+				errs.add("", fmt.Errorf("Unsupported config format: %s",
+					pluginName))
 			}
-		// Assume it's an input input for legacy config file support if no other
-		// identifiers are present
-		default:
-			if err = c.addInput(name, subTable); err != nil {
-				return fmt.Errorf("Error parsing %s, %s", name, err)
+		}
+	case "processors":
+		for _, pluginName := range sortedKeys(subTable.Fields) {
+			pluginVal := subTable.Fields[pluginName]
+			switch pluginSubTable := pluginVal.(type) {
+			case []*ast.Table:
+				for _, t := range pluginSubTable {
+					if err := c.addProcessor(p, pluginName, t); err != nil {
+						errs.add("Error parsing "+pluginName, err)
+					}
+				}
+			default:
+				errs.add("", fmt.Errorf("Unsupported config format: %s",
+					pluginName))
 			}
 		}
+	case "aggregators":
+		for _, pluginName := range sortedKeys(subTable.Fields) {
+			pluginVal := subTable.Fields[pluginName]
+			switch pluginSubTable := pluginVal.(type) {
+			case []*ast.Table:
+				for _, t := range pluginSubTable {
+					if err := c.addAggregator(p, pluginName, t); err != nil {
+						errs.add("Error parsing "+pluginName, err)
+					}
+				}
+			default:
+				errs.add("", fmt.Errorf("Unsupported config format: %s",
+					pluginName))
+			}
+		}
+	// Assume it's an input input for legacy config file support if no other
+	// identifiers are present
+	default:
+		if err := c.addInput(p, name, subTable); err != nil {
+			errs.add("Error parsing "+name, err)
+		}
+	}
+	return errs.err()
+}
+
+func (c *Config) addOutput(p *Pipeline, name string, table *ast.Table) error {
+	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters) {
+		return nil
+	}
+
+	creator, ok := output.Outputs[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested output: %s", name)
+	}
+	output := creator()
+
+	// If the output has a SetSerializer function, then this means it can write
+	// arbitrary types of output, so build the serializer and set it.
+	switch t := output.(type) {
+	case serializers.SerializerOutput:
+		serializer, err := buildSerializer(name, table)
+		if err != nil {
+			return err
+		}
+		t.SetSerializer(serializer)
+	}
+
+	outputConfig, err := buildOutput(name, table, c.Agent)
+	if err != nil {
+		return err
+	}
+	outputConfig.Pipeline = p.pluginPipeline()
+	if err := c.setOutputBuffer(p, outputConfig); err != nil {
+		return err
+	}
+	if err := c.checkOutputQueue(p, outputConfig); err != nil {
+		return err
+	}
+
+	if err := c.unmarshalTable(table, output); err != nil {
+		return err
+	}
+
+	if err := c.linkSecrets(output); err != nil {
+		return err
+	}
+
+	ro := models.NewRunningOutput(output, outputConfig,
+		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	p.Outputs = append(p.Outputs, ro)
+	return nil
+}
+
+// setOutputBuffer applies the agent buffer settings to the output of the
+// pipeline, each disk buffer gets its own directory named after the output
+// and its alias.
+func (c *Config) setOutputBuffer(p *Pipeline, oc *models.OutputConfig) error {
+	if oc.BufferStrategy == "" {
+		oc.BufferStrategy = c.Agent.BufferStrategy
+	}
+	if oc.BufferStrategy != models.BufferStrategyDisk {
+		return nil
+	}
+	if c.Agent.BufferDirectory == "" {
+		return fmt.Errorf("the %q buffer strategy requires agent.buffer_directory", models.BufferStrategyDisk)
+	}
+
+	oc.BufferDirectory = filepath.Join(p.bufferDirectory(c.Agent), oc.ID())
+	oc.BufferMaxSize = c.Agent.BufferMaxSize.Size
+
+	for _, ro := range p.Outputs {
+		if ro.Config.BufferStrategy == models.BufferStrategyDisk &&
+			ro.Config.BufferDirectory == oc.BufferDirectory {
+			return fmt.Errorf("disk buffer %s is already used by another %s output, set a unique alias",
+				oc.BufferDirectory, oc.Name)
+		}
+	}
+	return nil
+}
+
+// checkOutputQueue checks that the spill log of the queue feeding the output,
+// named after the output and its alias, is not shared with another output.
+func (c *Config) checkOutputQueue(p *Pipeline, oc *models.OutputConfig) error {
+	if p.Channel(c.Agent, "outputs", "outputs").OverflowPolicy != models.OverflowSpill {
+		return nil
+	}
+	for _, ro := range p.Outputs {
+		if ro.Config.ID() == oc.ID() {
+			return fmt.Errorf("the spill log of the queue of output %s is already used by another "+
+				"%s output, set a unique alias", oc.ID(), oc.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Config) addProcessor(p *Pipeline, name string, table *ast.Table) error {
+	if len(c.ProcessorFilters) > 0 && !sliceContains(name, c.ProcessorFilters) {
+		return nil
+	}
+
+	creator, ok := processors.Processors[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested processor: %s", name)
+	}
+
+	processorConfig, err := buildProcessor(name, table)
+	if err != nil {
+		return err
+	}
+	processorConfig.Pipeline = p.pluginPipeline()
+
+	rf, err := c.newRunningProcessor(creator, processorConfig, table)
+	if err != nil {
+		return err
+	}
+	p.Processors = append(p.Processors, rf)
+
+	pt := processorTable{creator: creator, config: processorConfig, table: table}
+	p.processorTables = append(p.processorTables, pt)
+	if len(p.Aggregators) == 0 {
+		return nil
+	}
+	return c.addAggProcessor(p, pt)
+}
+
+// processorTable holds what is needed to build a processor again.
+type processorTable struct {
+	creator processors.StreamingCreator
+	config  *models.ProcessorConfig
+	table   *ast.Table
+}
+
+// addAggProcessor adds a copy of the processor run on the output of the
+// aggregators, it is only built once the pipeline has aggregators.
+func (c *Config) addAggProcessor(p *Pipeline, pt processorTable) error {
+	rf, err := c.newRunningProcessor(pt.creator, pt.config, pt.table)
+	if err != nil {
+		return err
+	}
+	p.AggProcessors = append(p.AggProcessors, rf)
+	return nil
+}
+
+// unwrappable is implemented by processors wrapping a pip.Processor, the
+// options are unmarshalled into the wrapped processor.
+type unwrappable interface {
+	Unwrap() pip.Processor
+}
+
+func (c *Config) newRunningProcessor(
+	creator processors.StreamingCreator,
+	processorConfig *models.ProcessorConfig,
+	table *ast.Table,
+) (*models.RunningProcessor, error) {
+	processor := creator()
+
+	if p, ok := processor.(unwrappable); ok {
+		if err := c.unmarshalTable(table, p.Unwrap()); err != nil {
+			return nil, err
+		}
+		if err := c.linkSecrets(p.Unwrap()); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := c.unmarshalTable(table, processor); err != nil {
+			return nil, err
+		}
+		if err := c.linkSecrets(processor); err != nil {
+			return nil, err
+		}
+	}
+
+	rf := models.NewRunningProcessor(processor, processorConfig)
+	return rf, nil
+}
+
+func (c *Config) addAggregator(p *Pipeline, name string, table *ast.Table) error {
+	if len(c.AggregatorFilters) > 0 && !sliceContains(name, c.AggregatorFilters) {
+		return nil
 	}
 
+	creator, ok := aggregators.Aggregators[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested aggregator: %s", name)
+	}
+	aggregator := creator()
+
+	conf, err := buildAggregator(name, table)
+	if err != nil {
+		return err
+	}
+	conf.Pipeline = p.pluginPipeline()
+
+	if err := c.unmarshalTable(table, aggregator); err != nil {
+		return err
+	}
+
+	if err := c.linkSecrets(aggregator); err != nil {
+		return err
+	}
+
+	p.Aggregators = append(p.Aggregators, models.NewRunningAggregator(aggregator, conf))
+	if len(p.Aggregators) > 1 {
+		return nil
+	}
+
+	// the processors added so far also run after the aggregators
+	var errs Errors
+	for _, pt := range p.processorTables {
+		errs.add("Error parsing "+pt.config.Name, c.addAggProcessor(p, pt))
+	}
+	return errs.err()
+}
+
+func (c *Config) addSecretStore(name string, table *ast.Table) error {
+	creator, ok := secretstores.SecretStores[name]
+	if !ok {
+		return fmt.Errorf("Undefined but requested secretstore: %s", name)
+	}
+
+	id := getConfigString(table, "id")
+	if id == "" {
+		return fmt.Errorf("missing id of secret store")
+	}
+	if _, ok := c.SecretStores[id]; ok {
+		return fmt.Errorf("duplicate secret store id %q", id)
+	}
+
+	store := creator()
+	if err := c.unmarshalTable(table, store); err != nil {
+		return err
+	}
+
+	if err := c.linkSecrets(store); err != nil {
+		return err
+	}
+
+	if err := store.Init(); err != nil {
+		return fmt.Errorf("initializing secret store %q: %w", id, err)
+	}
+
+	c.SecretStores[id] = store
 	return nil
 }
 
-func (c *Config) addInput(name string, table *ast.Table) error {
+func (c *Config) addInput(p *Pipeline, name string, table *ast.Table) error {
+	if len(c.InputFilters) > 0 && !sliceContains(name, c.InputFilters) {
+		return nil
+	}
 
 	creator, ok := input.Inputs[name]
 	if !ok {
@@ -217,14 +990,19 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	pluginConfig.Pipeline = p.pluginPipeline()
 
-	if err := toml.UnmarshalTable(table, input); err != nil {
+	if err := c.unmarshalTable(table, input); err != nil {
+		return err
+	}
+
+	if err := c.linkSecrets(input); err != nil {
 		return err
 	}
 
 	rp := models.NewRunningInput(input, pluginConfig)
 	rp.SetDefaultTags(c.Tags)
-	c.Inputs = append(c.Inputs, rp)
+	p.Inputs = append(p.Inputs, rp)
 	return nil
 }
 
@@ -233,6 +1011,23 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 // models.InputConfig to be inserted into models.RunningInput
 func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	cp := &models.InputConfig{Name: name}
+	cp.Alias = getConfigString(tbl, "alias")
+	cp.NameOverride = getConfigString(tbl, "name_override")
+	cp.MeasurementPrefix = getConfigString(tbl, "name_prefix")
+	cp.MeasurementSuffix = getConfigString(tbl, "name_suffix")
+
+	var errs Errors
+	errs.add("", getConfigDuration(tbl, "interval", &cp.Interval, mustBePositive))
+	errs.add("", getConfigDuration(tbl, "collection_jitter", &cp.CollectionJitter, mustNotBeNegative))
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	cp.Filter, err = buildFilter(tbl)
+	if err != nil {
+		return nil, err
+	}
 
 	cp.Tags = make(map[string]string)
 	if node, ok := tbl.Fields["tags"]; ok {
@@ -247,32 +1042,332 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	return cp, nil
 }
 
-// parseConfig loads a TOML configuration from a provided path and
-// returns the AST produced from the TOML parser. When loading the file, it
-// will find environment variables and replace them.
-func parseConfig(contents []byte) (*ast.Table, error) {
-	contents = trimBOM(contents)
+// buildProcessor parses Processor specific items from the ast.Table,
+// builds the filter and returns a
+// models.ProcessorConfig to be inserted into models.RunningProcessor
+func buildProcessor(name string, tbl *ast.Table) (*models.ProcessorConfig, error) {
+	conf := &models.ProcessorConfig{Name: name}
 
-	parameters := envVarRe.FindAllSubmatch(contents, -1)
-	for _, parameter := range parameters {
-		if len(parameter) != 3 {
-			continue
+	if node, ok := tbl.Fields["order"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Integer); ok {
+				var err error
+				conf.Order, err = strconv.ParseInt(b.Value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing int value for %s: %s", name, err)
+				}
+			}
+		}
+	}
+	delete(tbl.Fields, "order")
+
+	conf.Alias = getConfigString(tbl, "alias")
+
+	var err error
+	conf.Filter, err = buildFilter(tbl)
+	if err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
+
+// buildOutput parses output specific items from the ast.Table,
+// builds the filter and returns an
+// models.OutputConfig to be inserted into models.RunningInput.  The batch size
+// and buffer limit are checked together with the ones inherited from agent.
+// Note: error exists in the return for future calls that might require error
+func buildOutput(name string, tbl *ast.Table, agent *AgentConfig) (*models.OutputConfig, error) {
+	filter, err := buildFilter(tbl)
+	if err != nil {
+		return nil, err
+	}
+	oc := &models.OutputConfig{
+		Name:   name,
+		Filter: filter,
+	}
+
+	oc.Alias = getConfigString(tbl, "alias")
+	oc.StartupErrorBehavior = getConfigString(tbl, "startup_error_behavior")
+	oc.BufferStrategy = getConfigString(tbl, "buffer_strategy")
+	if oc.BufferStrategy != "" {
+		if err := checkBufferStrategy(oc.BufferStrategy); err != nil {
+			return nil, fmt.Errorf("buffer_strategy: %w", err)
 		}
+	}
 
-		var env_var []byte
-		if parameter[1] != nil {
-			env_var = parameter[1]
-		} else if parameter[2] != nil {
-			env_var = parameter[2]
+	var errs Errors
+	errs.add("", getConfigDuration(tbl, "flush_interval", &oc.FlushInterval, mustBePositive))
+	if _, ok := tbl.Fields["flush_jitter"]; ok {
+		var jitter time.Duration
+		if err := getConfigDuration(tbl, "flush_jitter", &jitter, mustNotBeNegative); err != nil {
+			errs.add("", err)
 		} else {
-			continue
+			oc.FlushJitter = &jitter
 		}
+	}
 
-		env_val, ok := os.LookupEnv(strings.TrimPrefix(string(env_var), "$"))
-		if ok {
-			env_val = escapeEnv(env_val)
-			contents = bytes.Replace(contents, parameter[0], []byte(env_val), 1)
+	// the lines are looked up first as getConfigInt removes the keys
+	limitLine := fieldLine(tbl.Fields["metric_buffer_limit"])
+	batchLine := fieldLine(tbl.Fields["metric_batch_size"])
+	errs.add("", getConfigInt(tbl, "metric_buffer_limit", &oc.MetricBufferLimit))
+	errs.add("", getConfigInt(tbl, "metric_batch_size", &oc.MetricBatchSize))
+	if limitLine != 0 && oc.MetricBufferLimit <= 0 {
+		errs.add("", fmt.Errorf("metric_buffer_limit (line %d): must be positive, got %d",
+			limitLine, oc.MetricBufferLimit))
+	}
+	if batchLine != 0 && oc.MetricBatchSize <= 0 {
+		errs.add("", fmt.Errorf("metric_batch_size (line %d): must be positive, got %d",
+			batchLine, oc.MetricBatchSize))
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	// an output inherits the agent's sizes, the effective ones are checked
+	// like AgentConfig.validate does
+	batchSize, bufferLimit := agent.MetricBatchSize, agent.MetricBufferLimit
+	if oc.MetricBatchSize > 0 {
+		batchSize = oc.MetricBatchSize
+	}
+	if oc.MetricBufferLimit > 0 {
+		bufferLimit = oc.MetricBufferLimit
+	}
+	if bufferLimit < batchSize {
+		if limitLine != 0 {
+			return nil, fmt.Errorf("metric_buffer_limit (line %d): must not be less than metric_batch_size (%d), got %d",
+				limitLine, batchSize, bufferLimit)
 		}
+		return nil, fmt.Errorf("metric_batch_size (line %d): must not be greater than metric_buffer_limit (%d), got %d",
+			batchLine, bufferLimit, batchSize)
+	}
+
+	return oc, nil
+}
+
+// buildSerializer grabs the necessary entries from the ast.Table for creating
+// a serializers.Serializer object, and creates it, which can then be added onto
+// an Output object.
+func buildSerializer(name string, tbl *ast.Table) (serializers.Serializer, error) {
+	c := &serializers.Config{}
+
+	c.DataFormat = getConfigString(tbl, "data_format")
+	if c.DataFormat == "" {
+		c.DataFormat = "influx"
+	}
+
+	if err := getConfigDuration(tbl, "json_timestamp_units", &c.TimestampUnits); err != nil {
+		return nil, err
+	}
+
+	return serializers.NewSerializer(c)
+}
+
+// buildAggregator parses Aggregator specific items from the ast.Table,
+// builds the filter and returns a
+// models.AggregatorConfig to be inserted into models.RunningAggregator
+func buildAggregator(name string, tbl *ast.Table) (*models.AggregatorConfig, error) {
+	conf := &models.AggregatorConfig{
+		Name:   name,
+		Delay:  time.Millisecond * 100,
+		Period: time.Second * 30,
+		Grace:  time.Second * 0,
+	}
+
+	conf.Alias = getConfigString(tbl, "alias")
+
+	var errs Errors
+	errs.add("", getConfigDuration(tbl, "period", &conf.Period, mustBePositive))
+	errs.add("", getConfigDuration(tbl, "delay", &conf.Delay, mustNotBeNegative))
+	errs.add("", getConfigDuration(tbl, "grace", &conf.Grace, mustNotBeNegative))
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	conf.Filter, err = buildFilter(tbl)
+	if err != nil {
+		return nil, err
+	}
+
+	if node, ok := tbl.Fields["drop_original"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				var err error
+				conf.DropOriginal, err = b.Boolean()
+				if err != nil {
+					return nil, fmt.Errorf("error parsing boolean value for %s: %s", name, err)
+				}
+			}
+		}
+	}
+
+	delete(tbl.Fields, "drop_original")
+	return conf, nil
+}
+
+// buildFilter builds a Filter
+// (tagpass/tagdrop/namepass/namedrop/fieldpass/fielddrop) to
+// be inserted into the models.OutputConfig/models.InputConfig
+// to be used for glob filtering on tags and measurements
+func buildFilter(tbl *ast.Table) (models.Filter, error) {
+	f := models.Filter{}
+
+	f.NamePass = getConfigStringSlice(tbl, "namepass")
+	f.NameDrop = getConfigStringSlice(tbl, "namedrop")
+	f.FieldPass = getConfigStringSlice(tbl, "fieldpass")
+	f.FieldDrop = getConfigStringSlice(tbl, "fielddrop")
+	f.TagPass = getConfigTagFilters(tbl, "tagpass")
+	f.TagDrop = getConfigTagFilters(tbl, "tagdrop")
+	f.TagExclude = getConfigStringSlice(tbl, "tagexclude")
+	f.TagInclude = getConfigStringSlice(tbl, "taginclude")
+
+	if err := f.Compile(); err != nil {
+		return f, err
+	}
+
+	delete(tbl.Fields, "namedrop")
+	delete(tbl.Fields, "namepass")
+	delete(tbl.Fields, "fielddrop")
+	delete(tbl.Fields, "fieldpass")
+	delete(tbl.Fields, "tagdrop")
+	delete(tbl.Fields, "tagpass")
+	delete(tbl.Fields, "tagexclude")
+	delete(tbl.Fields, "taginclude")
+	return f, nil
+}
+
+// getConfigInt parses the integer stored under key and removes the key from
+// the table.
+func getConfigInt(tbl *ast.Table, key string, target *int) error {
+	if node, ok := tbl.Fields[key]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				v, err := integer.Int()
+				if err != nil {
+					return fmt.Errorf("error parsing %s at line %d: %w", key, kv.Line, err)
+				}
+				*target = int(v)
+			}
+		}
+		delete(tbl.Fields, key)
+	}
+	return nil
+}
+
+// getConfigString returns the string stored under key and removes the key
+// from the table.
+func getConfigString(tbl *ast.Table, key string) string {
+	var value string
+	if node, ok := tbl.Fields[key]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				value = str.Value
+			}
+		}
+		delete(tbl.Fields, key)
+	}
+	return value
+}
+
+// getConfigStringSlice returns the string array stored under key.
+func getConfigStringSlice(tbl *ast.Table, key string) []string {
+	var values []string
+	if node, ok := tbl.Fields[key]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if ary, ok := kv.Value.(*ast.Array); ok {
+				for _, elem := range ary.Value {
+					if str, ok := elem.(*ast.String); ok {
+						values = append(values, str.Value)
+					}
+				}
+			}
+		}
+	}
+	return values
+}
+
+// getConfigTagFilters returns the tag filters of the sub-table stored under
+// key, ie: [inputs.simple.tagpass] with tag names mapped to value globs.
+func getConfigTagFilters(tbl *ast.Table, key string) []models.TagFilter {
+	var filters []models.TagFilter
+	if node, ok := tbl.Fields[key]; ok {
+		if subtbl, ok := node.(*ast.Table); ok {
+			for name, val := range subtbl.Fields {
+				if kv, ok := val.(*ast.KeyValue); ok {
+					tagfilter := models.TagFilter{Name: name}
+					if ary, ok := kv.Value.(*ast.Array); ok {
+						for _, elem := range ary.Value {
+							if str, ok := elem.(*ast.String); ok {
+								tagfilter.Filter = append(tagfilter.Filter, str.Value)
+							}
+						}
+					}
+					filters = append(filters, tagfilter)
+				}
+			}
+		}
+	}
+	return filters
+}
+
+// getConfigDuration parses the duration stored under key with the rules of
+// internal.Duration, strings such as "10s" or integers and floats of seconds,
+// and removes the key from the table.  The checks validate the value, their
+// errors name the key and its line.
+func getConfigDuration(
+	tbl *ast.Table,
+	key string,
+	target *time.Duration,
+	checks ...func(time.Duration) error,
+) error {
+	node, ok := tbl.Fields[key]
+	if !ok {
+		return nil
+	}
+	delete(tbl.Fields, key)
+
+	kv, ok := node.(*ast.KeyValue)
+	if !ok {
+		return fmt.Errorf("error parsing %s at line %d: must be a duration", key, fieldLine(node))
+	}
+	var d internal.Duration
+	if err := d.UnmarshalTOML([]byte(kv.Value.Source())); err != nil {
+		return fmt.Errorf("error parsing %s at line %d: invalid duration %s", key, kv.Line, kv.Value.Source())
+	}
+	for _, check := range checks {
+		if err := check(d.Duration); err != nil {
+			return fmt.Errorf("%s (line %d): %w", key, kv.Line, err)
+		}
+	}
+	*target = d.Duration
+	return nil
+}
+
+// mustBePositive is a check of getConfigDuration.
+func mustBePositive(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("must be positive, got %s", d)
+	}
+	return nil
+}
+
+// mustNotBeNegative is a check of getConfigDuration.
+func mustNotBeNegative(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("must not be negative, got %s", d)
+	}
+	return nil
+}
+
+// parseConfig loads a TOML configuration from a provided path and
+// returns the AST produced from the TOML parser. When loading the file, it
+// will find environment variables and replace them.
+func parseConfig(contents []byte) (*ast.Table, error) {
+	contents = trimBOM(contents)
+
+	contents, err := substituteEnvVars(contents)
+	if err != nil {
+		return nil, err
 	}
 
 	return toml.Parse(contents)
@@ -756,3 +1851,23 @@ func getParserConfig(name string, tbl *ast.Table) (*parsers.Config, error) {
 
 	return c, nil
 }
+
+// sortedKeys returns the keys of the table fields in sorted order.
+func sortedKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sliceContains returns true if the list contains name.
+func sliceContains(name string, list []string) bool {
+	for _, b := range list {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
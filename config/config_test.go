@@ -0,0 +1,507 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+	_ "ezreal.com.cn/pip/pip/aggregators/minmax"
+	_ "ezreal.com.cn/pip/pip/input/simple"
+	"ezreal.com.cn/pip/pip/models"
+	_ "ezreal.com.cn/pip/pip/output/simple"
+	_ "ezreal.com.cn/pip/pip/processors/printer"
+)
+
+// checkLoadError loads the config and checks the error contains want, or
+// that there is no error when want is empty.
+func checkLoadError(t *testing.T, c *Config, data string, want string) {
+	t.Helper()
+	err := c.LoadConfigData([]byte(data))
+	if want == "" {
+		if err != nil {
+			t.Fatalf("LoadConfigData() error = %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("LoadConfigData() error = %v, want it to contain %q", err, want)
+	}
+}
+
+func TestOutputQueueSpillLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "unique aliases",
+			config: `
+[agent]
+  buffer_directory = "/tmp/pip"
+  overflow_policy = "spill-to-disk"
+[[outputs.simpleoutput]]
+  alias = "a"
+[[outputs.simpleoutput]]
+  alias = "b"
+`,
+		},
+		{
+			name: "shared spill log",
+			config: `
+[agent]
+  buffer_directory = "/tmp/pip"
+  overflow_policy = "spill-to-disk"
+[[outputs.simpleoutput]]
+[[outputs.simpleoutput]]
+`,
+			wantErr: "spill log of the queue of output simpleoutput is already used",
+		},
+		{
+			name: "no spill log",
+			config: `
+[[outputs.simpleoutput]]
+[[outputs.simpleoutput]]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkLoadError(t, NewConfig(), tt.config, tt.wantErr)
+		})
+	}
+}
+
+func TestAggProcessorsBuiltWithAggregators(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         []string
+		processors    int
+		aggProcessors int
+	}{
+		{
+			name: "no aggregators",
+			files: []string{`
+[[processors.printer]]
+[[processors.printer]]
+  alias = "second"
+`},
+			processors:    2,
+			aggProcessors: 0,
+		},
+		{
+			name: "with aggregators",
+			files: []string{`
+[[processors.printer]]
+[[aggregators.minmax]]
+  period = "30s"
+[[aggregators.minmax]]
+  alias = "second"
+  period = "30s"
+`},
+			processors:    1,
+			aggProcessors: 1,
+		},
+		{
+			name: "aggregators in a later file",
+			files: []string{`
+[[processors.printer]]
+`, `
+[[aggregators.minmax]]
+  period = "30s"
+[[processors.printer]]
+  alias = "second"
+`},
+			processors:    2,
+			aggProcessors: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			for _, data := range tt.files {
+				checkLoadError(t, c, data, "")
+			}
+			if n := len(c.Processors); n != tt.processors {
+				t.Errorf("got %d processors, want %d", n, tt.processors)
+			}
+			if n := len(c.AggProcessors); n != tt.aggProcessors {
+				t.Errorf("got %d aggregator processors, want %d", n, tt.aggProcessors)
+			}
+			for i := range c.AggProcessors {
+				if c.AggProcessors[i].Processor == c.Processors[i].Processor {
+					t.Errorf("processor %d shared between the two chains", i)
+				}
+			}
+		})
+	}
+}
+
+func TestAgentConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+		check   func(t *testing.T, a *AgentConfig)
+	}{
+		{
+			name:   "defaults",
+			config: ``,
+			check: func(t *testing.T, a *AgentConfig) {
+				if a.Interval.Duration != 10*time.Second || a.MetricBatchSize != 1000 {
+					t.Errorf("defaults not applied: interval %s, batch size %d",
+						a.Interval.Duration, a.MetricBatchSize)
+				}
+			},
+		},
+		{
+			name: "values",
+			config: `
+[agent]
+  interval = "5s"
+  flush_interval = 2
+  metric_batch_size = 10
+  metric_buffer_limit = 100
+`,
+			check: func(t *testing.T, a *AgentConfig) {
+				if a.Interval.Duration != 5*time.Second || a.FlushInterval.Duration != 2*time.Second {
+					t.Errorf("interval %s, flush interval %s", a.Interval.Duration, a.FlushInterval.Duration)
+				}
+				if a.MetricBatchSize != 10 || a.MetricBufferLimit != 100 {
+					t.Errorf("batch size %d, buffer limit %d", a.MetricBatchSize, a.MetricBufferLimit)
+				}
+			},
+		},
+		{
+			name:    "negative interval",
+			config:  "[agent]\n  interval = \"-1s\"\n",
+			wantErr: "agent.interval (line 2): must be positive",
+		},
+		{
+			name:    "buffer limit below batch size",
+			config:  "[agent]\n  metric_batch_size = 100\n  metric_buffer_limit = 10\n",
+			wantErr: "agent.metric_buffer_limit (line 3): must not be less than metric_batch_size",
+		},
+		{
+			name:    "unknown startup behavior",
+			config:  "[agent]\n  output_startup_error_behavior = \"ignore\"\n",
+			wantErr: `output_startup_error_behavior (line 2): must be "error" or "retry"`,
+		},
+		{
+			name:    "unknown channel stage",
+			config:  "[agent]\n  [agent.channels.inputs]\n    capacity = 1\n",
+			wantErr: `unknown stage "inputs"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			checkLoadError(t, c, tt.config, tt.wantErr)
+			if tt.check != nil {
+				tt.check(t, c.Agent)
+			}
+		})
+	}
+}
+
+type initInput struct {
+	err   error
+	calls int
+}
+
+func (i *initInput) Description() string              { return "init counter" }
+func (i *initInput) SampleConfig() string             { return "" }
+func (i *initInput) Gather(acc pip.Accumulator) error { return nil }
+
+func (i *initInput) Init() error {
+	i.calls++
+	return i.err
+}
+
+func TestInitPluginsOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr string
+	}{
+		{name: "success"},
+		{name: "failure", err: errors.New("bad setting"), wantErr: "inputs.init: bad setting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			input := &initInput{err: tt.err}
+			c.Inputs = append(c.Inputs, models.NewRunningInput(input, &models.InputConfig{Name: "init"}))
+
+			// a reload checks the config before the agent runs it
+			for i := 0; i < 2; i++ {
+				err := c.InitPlugins()
+				if tt.wantErr == "" && err != nil {
+					t.Fatalf("InitPlugins() error = %v", err)
+				}
+				if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+					t.Fatalf("InitPlugins() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+			}
+			if input.calls != 1 {
+				t.Errorf("Init called %d times, want 1", input.calls)
+			}
+		})
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	const data = `
+[agent]
+  intervall = "5s"
+[[inputs.simple]]
+  tip = "a"
+  tips = "b"
+`
+	tests := []struct {
+		name     string
+		config   string
+		strict   bool
+		wantErr  string
+		warnings []string
+	}{
+		{
+			name:   "warned",
+			config: data,
+			warnings: []string{
+				`W! [config] agent: line 3: unknown key "intervall", it is ignored`,
+				`W! [config] simple: line 6: unknown key "tips", it is ignored`,
+			},
+		},
+		{
+			name:    "strict",
+			config:  data,
+			strict:  true,
+			wantErr: `line 3: unknown key "intervall"`,
+		},
+		{
+			name:    "wrong type is an error without strict",
+			config:  "[[inputs.simple]]\n  tip = 1\n",
+			wantErr: "simple",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			defer log.SetOutput(os.Stderr)
+
+			c := NewConfig()
+			c.Strict = tt.strict
+			checkLoadError(t, c, tt.config, tt.wantErr)
+			for _, w := range tt.warnings {
+				if !strings.Contains(buf.String(), w) {
+					t.Errorf("warning %q not logged, got:\n%s", w, buf.String())
+				}
+			}
+			if len(tt.warnings) == 0 && strings.Contains(buf.String(), "unknown key") {
+				t.Errorf("unexpected warnings:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestPipelineNames(t *testing.T) {
+	c := NewConfig()
+	checkLoadError(t, c, `
+[[inputs.simple]]
+[[outputs.simpleoutput]]
+  alias = "main"
+
+[pipelines.web]
+  [[pipelines.web.inputs.simple]]
+  [[pipelines.web.processors.printer]]
+  [[pipelines.web.aggregators.minmax]]
+    period = "30s"
+  [[pipelines.web.outputs.simpleoutput]]
+    alias = "main"
+`, "")
+
+	tests := []struct {
+		name     string
+		pipeline *Pipeline
+		want     string // pipeline tag and log name prefix
+	}{
+		{name: "default pipeline", pipeline: c.Pipeline, want: ""},
+		{name: "named pipeline", pipeline: c.Pipelines["web"], want: "web"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := ""
+			if tt.want != "" {
+				prefix = tt.want + "."
+			}
+
+			p := tt.pipeline
+			input, output := p.Inputs[0], p.Outputs[0]
+			if got := input.LogName(); got != prefix+"inputs.simple" {
+				t.Errorf("input LogName() = %q, want %q", got, prefix+"inputs.simple")
+			}
+			if got := output.LogName(); got != prefix+"outputs.simpleoutput::main" {
+				t.Errorf("output LogName() = %q, want %q", got, prefix+"outputs.simpleoutput::main")
+			}
+			if got := input.MetricsGathered.Tags()["pipeline"]; got != tt.want {
+				t.Errorf("input pipeline tag = %q, want %q", got, tt.want)
+			}
+			if got := output.WriteErrors.Tags()["pipeline"]; got != tt.want {
+				t.Errorf("output pipeline tag = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" {
+				return
+			}
+			if got := p.Processors[0].LogName(); got != prefix+"processors.printer" {
+				t.Errorf("processor LogName() = %q, want %q", got, prefix+"processors.printer")
+			}
+			if got := p.Aggregators[0].LogName(); got != prefix+"aggregators.minmax" {
+				t.Errorf("aggregator LogName() = %q, want %q", got, prefix+"aggregators.minmax")
+			}
+			if got := p.Aggregators[0].MetricsPushed.Tags()["pipeline"]; got != tt.want {
+				t.Errorf("aggregator pipeline tag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluginDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		want     time.Duration
+		wantErr  string
+	}{
+		{name: "string", interval: `"15s"`, want: 15 * time.Second},
+		{name: "integer seconds", interval: `10`, want: 10 * time.Second},
+		{name: "float seconds", interval: `0.5`, want: 500 * time.Millisecond},
+		{name: "invalid string", interval: `"soon"`, wantErr: `error parsing interval at line 3: invalid duration "soon"`},
+		{name: "boolean", interval: `true`, wantErr: "error parsing interval at line 3: invalid duration true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			checkLoadError(t, c, "\n[[inputs.simple]]\n  interval = "+tt.interval+"\n", tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+			if got := c.Inputs[0].Config.Interval; got != tt.want {
+				t.Errorf("interval = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr []string
+	}{
+		{name: "valid", config: "interval = \"5s\"\n  collection_jitter = \"1s\""},
+		{name: "no jitter", config: "collection_jitter = 0"},
+		{name: "negative interval", config: `interval = "-1s"`,
+			wantErr: []string{"Error parsing simple: interval (line 3): must be positive, got -1s"}},
+		{name: "zero interval", config: `interval = "0s"`,
+			wantErr: []string{"interval (line 3): must be positive, got 0s"}},
+		{name: "negative jitter", config: `collection_jitter = "-1s"`,
+			wantErr: []string{"collection_jitter (line 3): must not be negative, got -1s"}},
+		{name: "both reported", config: "interval = 0\n  collection_jitter = -1", wantErr: []string{
+			"interval (line 3): must be positive",
+			"collection_jitter (line 4): must not be negative",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConfig().LoadConfigData([]byte("\n[[inputs.simple]]\n  " + tt.config + "\n"))
+			checkErrors(t, err, tt.wantErr)
+		})
+	}
+}
+
+// checkErrors checks err contains every message of want, or that there is no
+// error when want is empty.
+func checkErrors(t *testing.T, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("no error, want %q", want)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("error = %v, want it to contain %q", err, w)
+		}
+	}
+}
+
+func TestAggregatorSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr []string
+	}{
+		{name: "valid", config: "period = \"30s\"\n  delay = \"1s\"\n  grace = 0"},
+		{name: "zero period", config: `period = "0s"`,
+			wantErr: []string{"Error parsing minmax: period (line 3): must be positive, got 0s"}},
+		{name: "negative period", config: `period = "-30s"`,
+			wantErr: []string{"period (line 3): must be positive, got -30s"}},
+		{name: "negative delay and grace", config: "delay = \"-1s\"\n  grace = \"-2s\"", wantErr: []string{
+			"delay (line 3): must not be negative, got -1s",
+			"grace (line 4): must not be negative, got -2s",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConfig().LoadConfigData([]byte("\n[[aggregators.minmax]]\n  " + tt.config + "\n"))
+			checkErrors(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestOutputSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		agent   string
+		config  string
+		wantErr []string
+	}{
+		{name: "valid", config: "flush_interval = \"5s\"\n  flush_jitter = 0\n  metric_batch_size = 10\n  metric_buffer_limit = 100"},
+		{name: "negative flush interval", config: `flush_interval = "-1s"`,
+			wantErr: []string{"Error parsing simpleoutput array: flush_interval (line 3): must be positive, got -1s"}},
+		{name: "negative flush jitter", config: `flush_jitter = "-1s"`,
+			wantErr: []string{"flush_jitter (line 3): must not be negative, got -1s"}},
+		{name: "negative sizes", config: "metric_batch_size = -1\n  metric_buffer_limit = 0", wantErr: []string{
+			"metric_buffer_limit (line 4): must be positive, got 0",
+			"metric_batch_size (line 3): must be positive, got -1",
+		}},
+		{name: "limit below batch size", config: "metric_batch_size = 100\n  metric_buffer_limit = 10",
+			wantErr: []string{"metric_buffer_limit (line 4): must not be less than metric_batch_size (100), got 10"}},
+		{name: "limit below agent batch size", agent: "metric_batch_size = 500", config: "metric_buffer_limit = 100",
+			wantErr: []string{"metric_buffer_limit (line 5): must not be less than metric_batch_size (500), got 100"}},
+		{name: "batch size above agent limit", config: "metric_batch_size = 20000",
+			wantErr: []string{"metric_batch_size (line 3): must not be greater than metric_buffer_limit (10000), got 20000"}},
+		{name: "batch size within own limit", config: "metric_batch_size = 20000\n  metric_buffer_limit = 50000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "\n[[outputs.simpleoutput]]\n  " + tt.config + "\n"
+			if tt.agent != "" {
+				data = "[agent]\n  " + tt.agent + "\n" + data
+			}
+			err := NewConfig().LoadConfigData([]byte(data))
+			checkErrors(t, err, tt.wantErr)
+		})
+	}
+}
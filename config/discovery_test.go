@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setEnv sets or, when value is empty, unsets the variable for the test.
+func setEnv(t *testing.T, name, value string) {
+	t.Helper()
+	saved, exists := os.LookupEnv(name)
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+	t.Cleanup(func() {
+		if exists {
+			os.Setenv(name, saved)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestGetDefaultConfigPath(t *testing.T) {
+	if _, err := os.Stat("/etc/pip/pip.toml"); err == nil {
+		t.Skip("/etc/pip/pip.toml exists")
+	}
+
+	tests := []struct {
+		name    string
+		files   []string // created under the test directory
+		envPath string   // $PIP_CONFIG_PATH relative to the test directory
+		envURL  string
+		want    string // relative to the test directory
+		wantErr bool
+	}{
+		{name: "nothing found", wantErr: true},
+		{name: "home file", files: []string{"home/.pip/pip.toml"}, want: "home/.pip/pip.toml"},
+		{
+			name:  "local file before home file",
+			files: []string{"work/pip_config.toml", "home/.pip/pip.toml"},
+			want:  "./pip_config.toml",
+		},
+		{
+			name:    "environment first",
+			files:   []string{"env.toml", "work/pip_config.toml", "home/.pip/pip.toml"},
+			envPath: "env.toml",
+			want:    "env.toml",
+		},
+		{
+			name:    "missing environment file skipped",
+			files:   []string{"home/.pip/pip.toml"},
+			envPath: "missing.toml",
+			want:    "home/.pip/pip.toml",
+		},
+		{name: "environment url", envURL: "https://config.example.com/pip.toml", want: "https://config.example.com/pip.toml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "discovery")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for _, name := range append(tt.files, "work/", "home/") {
+				path := filepath.Join(dir, name)
+				if strings.HasSuffix(name, "/") {
+					os.MkdirAll(path, 0755)
+					continue
+				}
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := ioutil.WriteFile(path, []byte("[agent]\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			wd, _ := os.Getwd()
+			if err := os.Chdir(filepath.Join(dir, "work")); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			setEnv(t, "HOME", filepath.Join(dir, "home"))
+			switch {
+			case tt.envURL != "":
+				setEnv(t, "PIP_CONFIG_PATH", tt.envURL)
+			case tt.envPath != "":
+				setEnv(t, "PIP_CONFIG_PATH", filepath.Join(dir, tt.envPath))
+			default:
+				setEnv(t, "PIP_CONFIG_PATH", "")
+			}
+
+			got, err := getDefaultConfigPath()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("getDefaultConfigPath() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getDefaultConfigPath() error = %v", err)
+			}
+
+			want := tt.want
+			if tt.envURL == "" && !strings.HasPrefix(want, "./") {
+				want = filepath.Join(dir, want)
+			}
+			if got != want {
+				t.Errorf("getDefaultConfigPath() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// substituteEnvVars replaces environment variable references in the values
+// of the TOML document, comments, keys and table names are left untouched.
+// The supported forms are:
+//
+//	$VAR, ${VAR}        the value of VAR, kept as is when VAR is not set
+//	${VAR:-default}     default when VAR is unset or empty
+//	${VAR:?message}     an error with message when VAR is unset or empty
+//	$$                  a literal $
+//
+// Values inserted into basic strings are escaped. Every missing required
+// variable is reported in the returned error.
+func substituteEnvVars(contents []byte) ([]byte, error) {
+	s := &envScanner{src: contents, line: 1}
+	s.scan()
+	if len(s.missing) > 0 {
+		return nil, fmt.Errorf("missing required environment variables:\n  %s",
+			strings.Join(s.missing, "\n  "))
+	}
+	return s.out.Bytes(), nil
+}
+
+type stringKind int
+
+const (
+	noString stringKind = iota
+	basicString
+	multilineBasicString
+	literalString
+	multilineLiteralString
+)
+
+type envScanner struct {
+	src     []byte
+	pos     int
+	line    int
+	out     bytes.Buffer
+	missing []string
+
+	inValue bool // after the '=' of a key/value pair
+	depth   int  // nesting of arrays and inline tables within a value
+	str     stringKind
+}
+
+func (s *envScanner) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(s.src[s.pos:], []byte(prefix))
+}
+
+// copy writes the next n bytes unchanged.
+func (s *envScanner) copy(n int) {
+	s.line += bytes.Count(s.src[s.pos:s.pos+n], []byte("\n"))
+	s.out.Write(s.src[s.pos : s.pos+n])
+	s.pos += n
+}
+
+func (s *envScanner) scan() {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch s.str {
+		case basicString, multilineBasicString:
+			switch {
+			case c == '\\' && s.pos+1 < len(s.src):
+				s.copy(2)
+			case c == '$':
+				s.substitute()
+			case s.str == multilineBasicString && s.hasPrefix(`"""`):
+				s.copy(3)
+				s.str = noString
+			case s.str == basicString && c == '"':
+				s.copy(1)
+				s.str = noString
+			default:
+				s.copy(1)
+			}
+			continue
+		case literalString, multilineLiteralString:
+			switch {
+			case c == '$':
+				s.substitute()
+			case s.str == multilineLiteralString && s.hasPrefix(`'''`):
+				s.copy(3)
+				s.str = noString
+			case s.str == literalString && c == '\'':
+				s.copy(1)
+				s.str = noString
+			default:
+				s.copy(1)
+			}
+			continue
+		}
+
+		switch c {
+		case '#':
+			end := bytes.IndexByte(s.src[s.pos:], '\n')
+			if end < 0 {
+				end = len(s.src) - s.pos
+			}
+			s.copy(end)
+		case '"', '\'':
+			kind := basicString
+			if c == '\'' {
+				kind = literalString
+			}
+			n := 1
+			if s.hasPrefix(strings.Repeat(string(c), 3)) {
+				kind++
+				n = 3
+			}
+			if s.inValue {
+				s.str = kind
+			} else {
+				// quoted key, copy it as is
+				end := bytes.IndexByte(s.src[s.pos+1:], c)
+				if end < 0 {
+					end = len(s.src) - s.pos - 1
+				}
+				n = end + 2
+			}
+			s.copy(n)
+		case '=':
+			if s.depth == 0 {
+				s.inValue = true
+			}
+			s.copy(1)
+		case '[', '{':
+			if s.inValue {
+				s.depth++
+			}
+			s.copy(1)
+		case ']', '}':
+			if s.inValue && s.depth > 0 {
+				s.depth--
+			}
+			s.copy(1)
+		case '\n':
+			if s.depth == 0 {
+				s.inValue = false
+			}
+			s.copy(1)
+		case '$':
+			if s.inValue {
+				s.substitute()
+			} else {
+				s.copy(1)
+			}
+		default:
+			s.copy(1)
+		}
+	}
+}
+
+// substitute expands the reference starting at the current '$'.
+func (s *envScanner) substitute() {
+	rest := s.src[s.pos:]
+	if bytes.HasPrefix(rest, []byte("$$")) {
+		s.out.WriteByte('$')
+		s.pos += 2
+		return
+	}
+
+	var name, op, arg string
+	var n int
+	if bytes.HasPrefix(rest, []byte("${")) {
+		end := bytes.IndexByte(rest, '}')
+		if end < 0 || bytes.IndexByte(rest[:end], '\n') >= 0 {
+			s.copy(1)
+			return
+		}
+		expr := string(rest[2:end])
+		n = end + 1
+		name = expr
+		if i := strings.Index(expr, ":"); i >= 0 && i+1 < len(expr) &&
+			(expr[i+1] == '-' || expr[i+1] == '?') {
+			name, op, arg = expr[:i], expr[i:i+2], expr[i+2:]
+		}
+		if !isEnvName(name) {
+			s.copy(1)
+			return
+		}
+	} else {
+		n = 1
+		for n < len(rest) && isEnvNameChar(rest[n]) {
+			n++
+		}
+		name = string(rest[1:n])
+		if name == "" {
+			s.copy(1)
+			return
+		}
+	}
+
+	value, ok := os.LookupEnv(name)
+	switch op {
+	case ":-":
+		if value == "" {
+			value, ok = arg, true
+		}
+	case ":?":
+		if value == "" {
+			if arg == "" {
+				arg = "not set"
+			}
+			s.missing = append(s.missing, fmt.Sprintf("line %d: %s: %s", s.line, name, arg))
+			ok = false
+		}
+	}
+	if !ok {
+		// leave unset variables untouched
+		s.copy(n)
+		return
+	}
+
+	if s.str == basicString || s.str == multilineBasicString {
+		value = escapeEnv(value)
+	}
+	s.out.WriteString(value)
+	s.pos += n
+}
+
+func isEnvNameChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isEnvNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
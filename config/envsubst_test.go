@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSubstituteEnvVars(t *testing.T) {
+	env := map[string]string{
+		"PIP_TEST_HOST":   "db.example.com",
+		"PIP_TEST_EMPTY":  "",
+		"PIP_TEST_QUOTED": `pa"ss\word`,
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+	os.Unsetenv("PIP_TEST_UNSET")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr []string
+	}{
+		{name: "bare reference", input: `host = "$PIP_TEST_HOST"`, want: `host = "db.example.com"`},
+		{name: "braced reference", input: `url = "http://${PIP_TEST_HOST}:80"`, want: `url = "http://db.example.com:80"`},
+		{name: "unquoted value", input: `port = ${PIP_TEST_PORT:-8080}`, want: `port = 8080`},
+		{name: "unset kept", input: `host = "$PIP_TEST_UNSET"`, want: `host = "$PIP_TEST_UNSET"`},
+		{name: "default when unset", input: `host = "${PIP_TEST_UNSET:-localhost}"`, want: `host = "localhost"`},
+		{name: "default when empty", input: `host = "${PIP_TEST_EMPTY:-localhost}"`, want: `host = "localhost"`},
+		{name: "default not used", input: `host = "${PIP_TEST_HOST:-localhost}"`, want: `host = "db.example.com"`},
+		{name: "required set", input: `host = "${PIP_TEST_HOST:?host needed}"`, want: `host = "db.example.com"`},
+		{name: "escaped dollar", input: `price = "$$5"`, want: `price = "$5"`},
+		{name: "escaped in basic string", input: `password = "$PIP_TEST_QUOTED"`, want: `password = "pa\"ss\\word"`},
+		{name: "raw in literal string", input: `password = '$PIP_TEST_QUOTED'`, want: `password = 'pa"ss\word'`},
+		{name: "multiline string", input: "body = \"\"\"\n$PIP_TEST_HOST\n\"\"\"", want: "body = \"\"\"\ndb.example.com\n\"\"\""},
+		{name: "array values", input: `hosts = ["$PIP_TEST_HOST", "b"]`, want: `hosts = ["db.example.com", "b"]`},
+		{name: "comment untouched", input: "# uses $PIP_TEST_HOST\nhost = 1", want: "# uses $PIP_TEST_HOST\nhost = 1"},
+		{name: "key untouched", input: `"$PIP_TEST_HOST" = 1`, want: `"$PIP_TEST_HOST" = 1`},
+		{name: "table name untouched", input: "[tags.$PIP_TEST_HOST]\n", want: "[tags.$PIP_TEST_HOST]\n"},
+		{name: "escaped quote in string", input: `a = "\"$PIP_TEST_HOST\""`, want: `a = "\"db.example.com\""`},
+		{
+			name:  "required missing",
+			input: "a = \"${PIP_TEST_UNSET:?set the password}\"\nb = \"${PIP_TEST_EMPTY:?}\"",
+			wantErr: []string{
+				"line 1: PIP_TEST_UNSET: set the password",
+				"line 2: PIP_TEST_EMPTY: not set",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := substituteEnvVars([]byte(tt.input))
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("substituteEnvVars() = %s, want an error", got)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("substituteEnvVars() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("substituteEnvVars() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
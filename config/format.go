@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Config file formats, YAML and JSON files are converted to TOML and then
+// loaded like TOML files.
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+var bareKeyRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// FormatOf returns the format of the config file from its extension, TOML
+// when the extension is unknown.
+func FormatOf(file string) string {
+	if u, ok := configURL(file); ok {
+		file = u.Path
+	}
+	switch strings.ToLower(path.Ext(file)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatTOML
+	}
+}
+
+// isConfigFile reports whether the file has the extension of a config file
+// format.
+func isConfigFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".toml", ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// Convert translates a config document between the TOML, YAML and JSON
+// formats. Comments are not preserved.
+func Convert(data []byte, from, to string) ([]byte, error) {
+	if from == to {
+		return data, nil
+	}
+
+	var doc map[string]interface{}
+	switch from {
+	case FormatTOML:
+		tbl, err := toml.Parse(trimBOM(data))
+		if err != nil {
+			return nil, err
+		}
+		doc = make(map[string]interface{})
+		if err := toml.UnmarshalTable(tbl, doc); err != nil {
+			return nil, err
+		}
+	case FormatYAML, FormatJSON:
+		var err error
+		if doc, err = decodeDocument(data, from); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", from)
+	}
+
+	switch to {
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := encodeTOMLTable(&buf, nil, doc); err != nil {
+			return nil, err
+		}
+		return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+	case FormatYAML:
+		return yaml.Marshal(doc)
+	case FormatJSON:
+		out, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unknown config format %q", to)
+	}
+}
+
+// decodeDocument decodes a YAML or JSON config into generic values with
+// string keys.
+func decodeDocument(data []byte, format string) (map[string]interface{}, error) {
+	var doc interface{}
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// keep integers integers
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if doc == nil {
+		return map[string]interface{}{}, nil
+	}
+	m, ok := normalize(doc).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the %s config must be a mapping of sections", format)
+	}
+	return m, nil
+}
+
+// normalize converts the map[interface{}]interface{} produced by the YAML
+// decoder to map[string]interface{}.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalize(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalize(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// encodeTOMLTable writes the keys of m, plain values first and the tables
+// and arrays of tables after them.
+func encodeTOMLTable(buf *bytes.Buffer, name []string, m map[string]interface{}) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var tables []string
+	for _, k := range keys {
+		v := m[k]
+		if v == nil {
+			// TOML has no null
+			continue
+		}
+		if _, ok := v.(map[string]interface{}); ok || isTableArray(v) {
+			tables = append(tables, k)
+			continue
+		}
+		buf.WriteString(tomlKey(k))
+		buf.WriteString(" = ")
+		if err := encodeTOMLValue(buf, v); err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(append(name, k), "."), err)
+		}
+		buf.WriteByte('\n')
+	}
+
+	for _, k := range tables {
+		tableName := append(append([]string{}, name...), k)
+		header := make([]string, len(tableName))
+		for i, n := range tableName {
+			header[i] = tomlKey(n)
+		}
+
+		switch v := m[k].(type) {
+		case map[string]interface{}:
+			if !onlyTables(v) {
+				fmt.Fprintf(buf, "\n[%s]\n", strings.Join(header, "."))
+			}
+			if err := encodeTOMLTable(buf, tableName, v); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, elem := range v {
+				fmt.Fprintf(buf, "\n[[%s]]\n", strings.Join(header, "."))
+				if err := encodeTOMLTable(buf, tableName, elem.(map[string]interface{})); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// onlyTables reports whether m has sub-tables and no plain values, its
+// header can be left out then.
+func onlyTables(m map[string]interface{}) bool {
+	for _, v := range m {
+		if _, ok := v.(map[string]interface{}); !ok && !isTableArray(v) {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+// isTableArray reports whether v is a non-empty list of tables.
+func isTableArray(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, elem := range list {
+		if _, ok := elem.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeTOMLValue(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		buf.WriteString(tomlString(v))
+	case bool:
+		fmt.Fprintf(buf, "%t", v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		fmt.Fprintf(buf, "%d", v)
+	case float32, float64:
+		s := fmt.Sprintf("%v", v)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		buf.WriteString(s)
+	case json.Number:
+		buf.WriteString(v.String())
+	case time.Time:
+		buf.WriteString(v.Format(time.RFC3339Nano))
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			if err := encodeTOMLValue(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(tomlKey(k))
+			buf.WriteString(" = ")
+			if err := encodeTOMLValue(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported value %v of type %T", v, v)
+	}
+	return nil
+}
+
+func tomlKey(k string) string {
+	if bareKeyRe.MatchString(k) {
+		return k
+	}
+	return tomlString(k)
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{file: "pip.toml", want: FormatTOML},
+		{file: "pip.yaml", want: FormatYAML},
+		{file: "pip.YML", want: FormatYAML},
+		{file: "/etc/pip/pip.json", want: FormatJSON},
+		{file: "pip.conf", want: FormatTOML},
+		{file: "https://config.example.com/pip.yaml?version=2", want: FormatYAML},
+		{file: "https://config.example.com/config", want: FormatTOML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if got := FormatOf(tt.file); got != tt.want {
+				t.Errorf("FormatOf(%q) = %q, want %q", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "a.toml", want: true},
+		{name: "b.yaml", want: true},
+		{name: "c.yml", want: true},
+		{name: "d.JSON", want: true},
+		{name: "e.conf", want: false},
+		{name: "f.toml.bak", want: false},
+		{name: "README", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isConfigFile(tt.name); got != tt.want {
+				t.Errorf("isConfigFile(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+const convertConfig = `
+[global_tags]
+  dc = "eu-1"
+
+[agent]
+  interval = "5s"
+  metric_batch_size = 100
+  round_interval = true
+
+[[inputs.simple]]
+  tip = "first"
+  [inputs.simple.tags]
+    role = "web"
+
+[[inputs.simple]]
+  alias = "second"
+  tip = "with \"quotes\""
+  namepass = ["cpu", "mem"]
+
+[[outputs.simpleoutput]]
+  ok = true
+`
+
+func TestConvertRoundTrip(t *testing.T) {
+	want, err := Convert([]byte(convertConfig), FormatTOML, FormatJSON)
+	if err != nil {
+		t.Fatalf("Convert() to JSON error = %v", err)
+	}
+
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			converted, err := Convert([]byte(convertConfig), FormatTOML, format)
+			if err != nil {
+				t.Fatalf("Convert() to %s error = %v", format, err)
+			}
+			back, err := Convert(converted, format, FormatTOML)
+			if err != nil {
+				t.Fatalf("Convert() from %s error = %v\n%s", format, err, converted)
+			}
+			got, err := Convert(back, FormatTOML, FormatJSON)
+			if err != nil {
+				t.Fatalf("Convert() of the round trip error = %v\n%s", err, back)
+			}
+			if string(got) != string(want) {
+				t.Errorf("round trip through %s changed the config:\n%s\nwant:\n%s", format, got, want)
+			}
+
+			c := NewConfig()
+			checkLoadError(t, c, string(back), "")
+			if len(c.Inputs) != 2 || len(c.Outputs) != 1 {
+				t.Errorf("got %d inputs and %d outputs, want 2 and 1", len(c.Inputs), len(c.Outputs))
+			}
+			if c.Agent.MetricBatchSize != 100 || c.Tags["dc"] != "eu-1" {
+				t.Errorf("agent or global tags not converted: batch size %d, tags %v",
+					c.Agent.MetricBatchSize, c.Tags)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		from string
+		to   string
+	}{
+		{name: "unknown source format", data: "", from: "ini", to: FormatTOML},
+		{name: "unknown target format", data: "[agent]\n", from: FormatTOML, to: "ini"},
+		{name: "invalid YAML", data: "agent: [", from: FormatYAML, to: FormatTOML},
+		{name: "JSON array", data: "[1, 2]", from: FormatJSON, to: FormatTOML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Convert([]byte(tt.data), tt.from, tt.to); err == nil {
+				t.Error("Convert() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.toml":            "[[inputs.simple]]\n  tip = \"toml\"\n",
+		"b.yaml":            "inputs:\n  simple:\n    - tip: yaml\n",
+		"c.json":            `{"outputs": {"simpleoutput": [{"ok": true}]}}`,
+		"d.txt":             "not a config",
+		"sub/e.yml":         "inputs:\n  simple:\n    - tip: nested\n",
+		"..data/f.toml":     "[[inputs.simple]]\n  tip = \"mounted twice\"\n",
+		"sub/g.toml.sample": "[[inputs.simple]]\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewConfig()
+	if err := c.LoadDirectory(dir); err != nil {
+		t.Fatalf("LoadDirectory() error = %v", err)
+	}
+	if len(c.Inputs) != 3 {
+		t.Errorf("got %d inputs, want 3", len(c.Inputs))
+	}
+	if len(c.Outputs) != 1 {
+		t.Errorf("got %d outputs, want 1", len(c.Outputs))
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ezreal.com.cn/pip/pip/models"
+	"github.com/influxdata/toml/ast"
+)
+
+// DefaultPipeline is the name of the pipeline made of the plugins defined at
+// the root of the config.
+const DefaultPipeline = "default"
+
+// Pipeline is a chain of inputs, processors, aggregators and outputs.  Each
+// pipeline of the agent runs with its own channels and can be started and
+// stopped independently of the others.
+type Pipeline struct {
+	Name string
+
+	// Channels overrides the agent channel settings for the stages of this
+	// pipeline.
+	Channels map[string]ChannelConfig
+
+	Inputs      []*models.RunningInput
+	Outputs     []*models.RunningOutput
+	Aggregators []*models.RunningAggregator
+	// Processors have a slice wrapper type because they need to be sorted
+	Processors    models.RunningProcessors
+	AggProcessors models.RunningProcessors
+
+	// processorTables holds the config of each processor, the processors
+	// run after the aggregators are built from it once there are any.
+	processorTables []processorTable
+}
+
+func newPipeline(name string) *Pipeline {
+	return &Pipeline{
+		Name:          name,
+		Channels:      make(map[string]ChannelConfig),
+		Inputs:        make([]*models.RunningInput, 0),
+		Outputs:       make([]*models.RunningOutput, 0),
+		Aggregators:   make([]*models.RunningAggregator, 0),
+		Processors:    make([]*models.RunningProcessor, 0),
+		AggProcessors: make([]*models.RunningProcessor, 0),
+	}
+}
+
+// empty reports whether no plugin was added to the pipeline.
+func (p *Pipeline) empty() bool {
+	return len(p.Inputs) == 0 && len(p.Outputs) == 0 && len(p.Aggregators) == 0 &&
+		len(p.Processors) == 0
+}
+
+// Channel returns the settings of the channel called name that feeds the
+// stage, the pipeline settings override the agent ones.
+func (p *Pipeline) Channel(a *AgentConfig, stage string, name string) *models.ChannelConfig {
+	if p.Name != DefaultPipeline {
+		name = p.Name + "." + name
+	}
+	return a.channel(name, a.Channels[stage], p.Channels[stage])
+}
+
+// pluginPipeline returns the pipeline name set on the plugins, it tags their
+// statistics and prefixes their log names.  It is empty for the default
+// pipeline.
+func (p *Pipeline) pluginPipeline() string {
+	if p.Name == DefaultPipeline {
+		return ""
+	}
+	return p.Name
+}
+
+// bufferDirectory returns the directory of the disk buffers of the pipeline
+// outputs.
+func (p *Pipeline) bufferDirectory(a *AgentConfig) string {
+	if p.Name == DefaultPipeline {
+		return a.BufferDirectory
+	}
+	return filepath.Join(a.BufferDirectory, "pipelines", p.Name)
+}
+
+// AllPipelines returns the pipelines to run: the default pipeline, unless it
+// is empty and named pipelines are defined, followed by the named pipelines in
+// name order.
+func (c *Config) AllPipelines() []*Pipeline {
+	var pipelines []*Pipeline
+	if !c.Pipeline.empty() || len(c.Pipelines) == 0 {
+		pipelines = append(pipelines, c.Pipeline)
+	}
+
+	names := make([]string, 0, len(c.Pipelines))
+	for name := range c.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pipelines = append(pipelines, c.Pipelines[name])
+	}
+	return pipelines
+}
+
+// pipeline returns the pipeline called name, creating it if needed.
+func (c *Config) pipeline(name string) *Pipeline {
+	if name == DefaultPipeline {
+		return c.Pipeline
+	}
+	p, ok := c.Pipelines[name]
+	if !ok {
+		p = newPipeline(name)
+		c.Pipelines[name] = p
+	}
+	return p
+}
+
+// loadPipeline adds the plugins and channel settings of a [pipelines.<name>]
+// table to the pipeline.
+func (c *Config) loadPipeline(name string, tbl *ast.Table) error {
+	if !bareKeyRe.MatchString(name) {
+		return fmt.Errorf("invalid pipeline name %q, use letters, digits, '_' and '-'", name)
+	}
+	p := c.pipeline(name)
+
+	var errs Errors
+	for _, section := range sortedKeys(tbl.Fields) {
+		subTable, ok := tbl.Fields[section].(*ast.Table)
+		if !ok {
+			errs.add("", fmt.Errorf("invalid configuration, error parsing field %q as table", section))
+			continue
+		}
+
+		switch section {
+		case "channels":
+			errs.add("", c.loadPipelineChannels(p, subTable))
+		case "inputs", "outputs", "processors", "aggregators":
+			errs.add("", c.addSection(p, section, subTable))
+		default:
+			errs.add("", fmt.Errorf("unknown section %q, must be one of channels, inputs, "+
+				"processors, aggregators or outputs", section))
+		}
+	}
+	return errs.err()
+}
+
+// loadPipelineChannels sets the channel settings of the pipeline from its
+// [pipelines.<name>.channels] table.
+func (c *Config) loadPipelineChannels(p *Pipeline, tbl *ast.Table) error {
+	var settings struct {
+		Channels map[string]ChannelConfig `toml:"channels"`
+	}
+	wrapper := &ast.Table{Fields: map[string]interface{}{"channels": tbl}}
+	if err := c.unmarshalTable(wrapper, &settings); err != nil {
+		return err
+	}
+
+	var errs Errors
+	for _, stage := range sortedKeys(tbl.Fields) {
+		if !sliceContains(stage, channelStages) {
+			errs.add("", fmt.Errorf("channels (line %d): unknown stage %q, must be one of %s",
+				fieldLine(tbl.Fields[stage]), stage, strings.Join(channelStages, ", ")))
+			continue
+		}
+		p.Channels[stage] = settings.Channels[stage]
+
+		cc := p.Channel(c.Agent, stage, stage)
+		if err := c.Agent.checkChannel(cc.Capacity, cc.OverflowPolicy); err != nil {
+			errs.add("", fmt.Errorf("channels.%s (line %d): %s", stage, fieldLine(tbl.Fields[stage]), err))
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/aggregators"
+	"ezreal.com.cn/pip/pip/input"
+	"ezreal.com.cn/pip/pip/output"
+	"ezreal.com.cn/pip/pip/processors"
+	"ezreal.com.cn/pip/pip/secretstores"
+)
+
+var header = `# pip Configuration
+#
+# pip is entirely plugin driven. All metrics are gathered from the
+# declared inputs, and sent to the declared outputs.
+#
+# Plugins must be declared in here to be active.
+# To deactivate a plugin, comment out the name and any variables.
+#
+# Use 'pip config > pip.toml' to create a config file with all plugins.
+#
+# Environment variables can be used anywhere in this config file, simply
+# surround them with ${}. For strings the variable must be within quotes
+# (ie, "${STR_VAR}"), for numbers and booleans they should be plain
+# (ie, ${INT_VAR}, ${BOOL_VAR}). ${VAR:-default} and ${VAR:?message}
+# give a default or require the variable, $$ is a literal $.
+
+`
+
+var globalTagsConfig = `
+# Global tags can be specified here in key="value" format.
+[global_tags]
+  # dc = "us-east-1" # will tag all metrics with dc=us-east-1
+  # rack = "1a"
+  ## Environment variables can be used as tags, and throughout the config file
+  # user = "$USER"
+
+`
+
+var agentConfig = `
+# Configuration for pip agent
+[agent]
+  ## Default data collection interval for all inputs
+  interval = "10s"
+  ## Rounds collection interval to 'interval'
+  ## ie, if interval="10s" then always collect on :00, :10, :20, etc.
+  round_interval = true
+  ## Each plugin sleeps for a random time within jitter before collecting
+  collection_jitter = "0s"
+  ## Rounds metric timestamps, derived from the interval when unset
+  # precision = "1s"
+
+  ## Default flushing interval for all outputs
+  flush_interval = "10s"
+  ## Jitter the flush interval by a random amount
+  flush_jitter = "0s"
+
+  ## Maximum number of metrics written to an output in one call
+  metric_batch_size = 1000
+  ## Maximum number of unwritten metrics buffered per output
+  metric_buffer_limit = 10000
+
+  ## Log at debug level
+  # debug = false
+  ## Log only error level messages
+  # quiet = false
+  ## One of "debug", "info", "warn" or "error"
+  # log_level = "info"
+  ## Log file name, empty logs to stderr
+  # logfile = ""
+
+  ## Override default hostname, if empty use os.Hostname()
+  hostname = ""
+  ## If set to true, do no set the "host" tag
+  omit_hostname = false
+
+  ## Number of Connect retries of an output at startup
+  # output_connect_retries = 1
+  ## Wait before the first retry, doubled after each failed attempt
+  # output_connect_retry_interval = "15s"
+  ## "error" fails startup once the retries are exhausted, "retry" starts
+  ## anyway and keeps connecting in the background
+  # output_startup_error_behavior = "error"
+
+  ## Buffer of the outputs, "memory" or "disk"; a disk buffer keeps unwritten
+  ## metrics across output outages and restarts, outputs may override it with
+  ## their own buffer_strategy
+  # buffer_strategy = "memory"
+  ## Directory of the disk buffers, one sub-directory per output
+  # buffer_directory = "/var/lib/pip/buffer"
+  ## Disk space each disk buffer may use before dropping the oldest metrics,
+  ## 0 is unlimited
+  # buffer_max_size = "512MiB"
+
+  ## Capacity of the channels feeding the processors, aggregators and outputs
+  # channel_capacity = 100
+  ## What happens when a metric is sent to a full channel: "block" waits for
+  ## room, "drop-newest" and "drop-oldest" drop a metric, "spill-to-disk"
+  ## writes it under buffer_directory until there is room
+  # overflow_policy = "block"
+  ## Per stage settings, stages are "processors", "aggregators" and "outputs";
+  ## the "outputs" settings also apply to the queue of each output
+  # [agent.channels.outputs]
+  #   capacity = 1000
+  #   overflow_policy = "drop-oldest"
+
+`
+
+var secretstoreHeader = `
+###############################################################################
+#                            SECRETSTORE PLUGINS                              #
+###############################################################################
+`
+
+var outputHeader = `
+###############################################################################
+#                            OUTPUT PLUGINS                                   #
+###############################################################################
+`
+
+var processorHeader = `
+###############################################################################
+#                            PROCESSOR PLUGINS                                #
+###############################################################################
+`
+
+var aggregatorHeader = `
+###############################################################################
+#                            AGGREGATOR PLUGINS                               #
+###############################################################################
+`
+
+var inputHeader = `
+###############################################################################
+#                            INPUT PLUGINS                                    #
+###############################################################################
+`
+
+var pipelinesConfig = `
+###############################################################################
+#                            PIPELINES                                        #
+###############################################################################
+
+## The plugins above make up the default pipeline.  Named pipelines run in
+## the same agent with their own inputs, processors, aggregators, outputs and
+## channels; starting, stopping or failing one does not affect the others.
+## Disk buffers and spilled metrics of a named pipeline are kept under
+## buffer_directory/pipelines/<name>.
+# [[pipelines.example.inputs.simple]]
+#
+# [[pipelines.example.outputs.simpleoutput]]
+#
+# ## Channel settings of the pipeline, they override the agent ones
+# [pipelines.example.channels.outputs]
+#   capacity = 1000
+#   overflow_policy = "drop-oldest"
+`
+
+var serviceInputHeader = `
+###############################################################################
+#                            SERVICE INPUT PLUGINS                            #
+###############################################################################
+`
+
+// PrintSampleConfig prints the sample config, the filters select the
+// sections and plugins to print. Without a filter every registered plugin is
+// printed, the ones not enabled by default commented out.
+func PrintSampleConfig(
+	sectionFilters []string,
+	inputFilters []string,
+	outputFilters []string,
+	aggregatorFilters []string,
+	processorFilters []string,
+) {
+	// print headers
+	fmt.Print(header)
+
+	if len(sectionFilters) == 0 {
+		sectionFilters = sectionDefaults
+	}
+	printFilteredGlobalSections(sectionFilters)
+
+	// print secret store plugins
+	if sliceContains("secretstores", sectionFilters) {
+		fmt.Print(secretstoreHeader)
+		for _, name := range sortedNames(secretstores.SecretStores) {
+			printConfig(name, secretstores.SecretStores[name](), "secretstores", true)
+		}
+	}
+
+	// print output plugins
+	if sliceContains("outputs", sectionFilters) {
+		fmt.Print(outputHeader)
+		if len(outputFilters) != 0 {
+			printFilteredOutputs(outputFilters, false)
+		} else {
+			printFilteredOutputs(outputDefaults, false)
+			// Print non-default outputs, commented
+			var pnames []string
+			for _, pname := range sortedNames(output.Outputs) {
+				if !sliceContains(pname, outputDefaults) {
+					pnames = append(pnames, pname)
+				}
+			}
+			printFilteredOutputs(pnames, true)
+		}
+	}
+
+	// print processor plugins
+	if sliceContains("processors", sectionFilters) {
+		fmt.Print(processorHeader)
+		if len(processorFilters) != 0 {
+			printFilteredProcessors(processorFilters, false)
+		} else {
+			printFilteredProcessors(sortedNames(processors.Processors), true)
+		}
+	}
+
+	// print aggregator plugins
+	if sliceContains("aggregators", sectionFilters) {
+		fmt.Print(aggregatorHeader)
+		if len(aggregatorFilters) != 0 {
+			printFilteredAggregators(aggregatorFilters, false)
+		} else {
+			printFilteredAggregators(sortedNames(aggregators.Aggregators), true)
+		}
+	}
+
+	// print input plugins
+	if sliceContains("inputs", sectionFilters) {
+		fmt.Print(inputHeader)
+		if len(inputFilters) != 0 {
+			printFilteredInputs(inputFilters, false)
+		} else {
+			printFilteredInputs(inputDefaults, false)
+			// Print non-default inputs, commented
+			var pnames []string
+			for _, pname := range sortedNames(input.Inputs) {
+				if !sliceContains(pname, inputDefaults) {
+					pnames = append(pnames, pname)
+				}
+			}
+			printFilteredInputs(pnames, true)
+		}
+	}
+
+	if sliceContains("pipelines", sectionFilters) {
+		fmt.Print(pipelinesConfig)
+	}
+}
+
+func printFilteredProcessors(processorFilters []string, commented bool) {
+	for _, pname := range processorFilters {
+		creator, ok := processors.Processors[pname]
+		if !ok {
+			continue
+		}
+		printConfig(pname, creator(), "processors", commented)
+	}
+}
+
+func printFilteredAggregators(aggregatorFilters []string, commented bool) {
+	for _, aname := range aggregatorFilters {
+		creator, ok := aggregators.Aggregators[aname]
+		if !ok {
+			continue
+		}
+		printConfig(aname, creator(), "aggregators", commented)
+	}
+}
+
+func printFilteredInputs(inputFilters []string, commented bool) {
+	// Print Inputs
+	servInputs := make(map[string]pip.ServiceInput)
+	var servInputNames []string
+	for _, pname := range inputFilters {
+		creator, ok := input.Inputs[pname]
+		if !ok {
+			continue
+		}
+		input := creator()
+
+		switch p := input.(type) {
+		case pip.ServiceInput:
+			servInputs[pname] = p
+			servInputNames = append(servInputNames, pname)
+			continue
+		}
+
+		printConfig(pname, input, "inputs", commented)
+	}
+
+	// Print Service Inputs
+	if len(servInputs) == 0 {
+		return
+	}
+	fmt.Print(serviceInputHeader)
+	for _, name := range servInputNames {
+		printConfig(name, servInputs[name], "inputs", commented)
+	}
+}
+
+func printFilteredOutputs(outputFilters []string, commented bool) {
+	for _, oname := range outputFilters {
+		creator, ok := output.Outputs[oname]
+		if !ok {
+			continue
+		}
+		printConfig(oname, creator(), "outputs", commented)
+	}
+}
+
+func printFilteredGlobalSections(sectionFilters []string) {
+	if sliceContains("global_tags", sectionFilters) {
+		fmt.Print(globalTagsConfig)
+	}
+
+	if sliceContains("agent", sectionFilters) {
+		fmt.Print(agentConfig)
+	}
+}
+
+func printConfig(name string, p pip.PluginDescriber, op string, commented bool) {
+	comment := ""
+	if commented {
+		comment = "# "
+	}
+	fmt.Printf("\n%s# %s\n%s[[%s.%s]]", comment, p.Description(), comment,
+		op, name)
+
+	config := p.SampleConfig()
+	if config == "" {
+		fmt.Printf("\n%s  # no configuration\n\n", comment)
+	} else {
+		lines := strings.Split(config, "\n")
+		for i, line := range lines {
+			if i == 0 || i == len(lines)-1 {
+				fmt.Print("\n")
+				continue
+			}
+			fmt.Print(strings.TrimRight(comment+line, " ") + "\n")
+		}
+	}
+}
+
+// PrintPluginDescriptions prints every registered plugin with its
+// description, grouped by plugin type.
+func PrintPluginDescriptions() {
+	printDescriptions("inputs", sortedNames(input.Inputs), func(name string) pip.PluginDescriber {
+		return input.Inputs[name]()
+	})
+	printDescriptions("outputs", sortedNames(output.Outputs), func(name string) pip.PluginDescriber {
+		return output.Outputs[name]()
+	})
+	printDescriptions("processors", sortedNames(processors.Processors), func(name string) pip.PluginDescriber {
+		return processors.Processors[name]()
+	})
+	printDescriptions("aggregators", sortedNames(aggregators.Aggregators), func(name string) pip.PluginDescriber {
+		return aggregators.Aggregators[name]()
+	})
+	printDescriptions("secretstores", sortedNames(secretstores.SecretStores), func(name string) pip.PluginDescriber {
+		return secretstores.SecretStores[name]()
+	})
+}
+
+func printDescriptions(op string, names []string, create func(name string) pip.PluginDescriber) {
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+
+	fmt.Printf("%s:\n", op)
+	for _, name := range names {
+		fmt.Printf("  %-*s  %s\n", width, name, create(name).Description())
+	}
+	fmt.Println()
+}
+
+// sortedNames returns the sorted names of a plugin registry.
+func sortedNames(registry interface{}) []string {
+	var names []string
+	switch r := registry.(type) {
+	case map[string]input.Creator:
+		for name := range r {
+			names = append(names, name)
+		}
+	case map[string]output.Creator:
+		for name := range r {
+			names = append(names, name)
+		}
+	case map[string]processors.StreamingCreator:
+		for name := range r {
+			names = append(names, name)
+		}
+	case map[string]aggregators.Creator:
+		for name := range r {
+			names = append(names, name)
+		}
+	case map[string]secretstores.Creator:
+		for name := range r {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
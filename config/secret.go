@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+var secretType = reflect.TypeOf(pip.Secret{})
+
+// linkSecrets links the Secret fields of the plugin to the secret stores,
+// nested structs are searched as well.
+func (c *Config) linkSecrets(plugin interface{}) error {
+	return linkSecretsValue(reflect.ValueOf(plugin), c.SecretStores)
+}
+
+func linkSecretsValue(v reflect.Value, stores map[string]pip.SecretStore) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported, not set from the config
+			continue
+		}
+
+		if field.Type == secretType {
+			secret := v.Field(i).Interface().(pip.Secret)
+			if err := secret.Link(stores); err != nil {
+				return fmt.Errorf("secret %s: %w", field.Name, err)
+			}
+			continue
+		}
+		if err := linkSecretsValue(v.Field(i), stores); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+type mapStore map[string]string
+
+func (s mapStore) Description() string         { return "map store" }
+func (s mapStore) SampleConfig() string        { return "" }
+func (s mapStore) Init() error                 { return nil }
+func (s mapStore) Set(key, value string) error { s[key] = value; return nil }
+func (s mapStore) List() ([]string, error)     { return nil, nil }
+
+func (s mapStore) Get(key string) ([]byte, error) {
+	value, ok := s[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found", key)
+	}
+	return []byte(value), nil
+}
+
+func newSecret(t *testing.T, ref string) pip.Secret {
+	t.Helper()
+	var s pip.Secret
+	if err := s.UnmarshalTOML([]byte(fmt.Sprintf("%q", ref))); err != nil {
+		t.Fatalf("UnmarshalTOML() error = %v", err)
+	}
+	return s
+}
+
+func TestSecretResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db_pass")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PIP_TEST_SECRET", "from-env")
+	defer os.Unsetenv("PIP_TEST_SECRET")
+
+	stores := map[string]pip.SecretStore{"vault": mapStore{"db": "from-store"}}
+
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{name: "literal", ref: "plain", want: "plain"},
+		{name: "file", ref: "@{file:" + path + "}", want: "from-file"},
+		{name: "env", ref: "@{env:PIP_TEST_SECRET}", want: "from-env"},
+		{name: "store", ref: "@{store:vault:db}", want: "from-store"},
+		{name: "missing file", ref: "@{file:" + filepath.Join(dir, "none") + "}", wantErr: "no such file"},
+		{name: "missing env", ref: "@{env:PIP_TEST_SECRET_UNSET}", wantErr: "PIP_TEST_SECRET_UNSET is not set"},
+		{name: "unknown store", ref: "@{store:other:db}", wantErr: `unknown secret store "other"`},
+		{name: "missing store key", ref: "@{store:vault:other}", wantErr: `secret "other" not found`},
+		{name: "invalid store reference", ref: "@{store:vault}", wantErr: "expected @{store:<id>:<key>}"},
+		{name: "unknown reference", ref: "@{vault:db}", wantErr: "unknown secret reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSecret(t, tt.ref)
+			err := s.Link(stores)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Link() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Link() error = %v", err)
+			}
+			value, err := s.Get()
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if string(value) != tt.want {
+				t.Errorf("Get() = %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretRotated(t *testing.T) {
+	os.Setenv("PIP_TEST_SECRET", "first")
+	defer os.Unsetenv("PIP_TEST_SECRET")
+
+	s := newSecret(t, "@{env:PIP_TEST_SECRET}")
+	if err := s.Link(nil); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	os.Setenv("PIP_TEST_SECRET", "second")
+	if value, _ := s.Get(); string(value) != "second" {
+		t.Errorf("Get() = %q after rotation, want %q", value, "second")
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	plugin := struct {
+		Password pip.Secret
+		Nested   struct{ Token pip.Secret }
+	}{Password: newSecret(t, "hunter2")}
+	plugin.Nested.Token = newSecret(t, "hunter2")
+	if err := linkSecretsValue(reflect.ValueOf(&plugin), nil); err != nil {
+		t.Fatalf("linkSecrets() error = %v", err)
+	}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		if s := fmt.Sprintf(format, plugin); strings.Contains(s, "hunter2") ||
+			strings.Contains(s, fmt.Sprintf("%x", "hunter2")) {
+			t.Errorf("%s shows the secret: %s", format, s)
+		}
+	}
+	buf, err := json.Marshal(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "hunter2") {
+		t.Errorf("JSON shows the secret: %s", buf)
+	}
+	if value, _ := plugin.Nested.Token.Get(); string(value) != "hunter2" {
+		t.Errorf("nested Get() = %q, want %q", value, "hunter2")
+	}
+}
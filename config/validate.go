@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/influxdata/toml"
+	"github.com/influxdata/toml/ast"
+)
+
+// Errors collects the problems found in a config so that all of them are
+// reported at once.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors:\n  %s", len(e), strings.Join(msgs, "\n  "))
+}
+
+// add appends err, the errors of an Errors are appended one by one with the
+// prefix.
+func (e *Errors) add(prefix string, err error) {
+	if err == nil {
+		return
+	}
+	if errs, ok := err.(Errors); ok {
+		for _, err := range errs {
+			e.add(prefix, err)
+		}
+		return
+	}
+	if prefix != "" {
+		err = fmt.Errorf("%s: %w", prefix, err)
+	}
+	*e = append(*e, err)
+}
+
+// err returns nil when no error was collected.
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// unmarshalTable sets the fields of v from tbl. Values of the wrong type are
+// all reported, unknown keys and missing required fields as well in strict
+// mode. Otherwise unknown keys are logged as warnings.
+func (c *Config) unmarshalTable(tbl *ast.Table, v interface{}) error {
+	var errs, unknown Errors
+	for _, key := range sortedKeys(tbl.Fields) {
+		field := tbl.Fields[key]
+		if _, ok := lookupField(reflect.TypeOf(v), key); !ok {
+			unknown.add("", fmt.Errorf("line %d: unknown key %q", fieldLine(field), key))
+			continue
+		}
+		unknown.add("", unknownKeys(tbl.Fields[key], reflect.TypeOf(v), key))
+
+		// unmarshal the keys one by one to report every type mismatch
+		single := &ast.Table{
+			Line:     tbl.Line,
+			Position: tbl.Position,
+			Name:     tbl.Name,
+			Type:     tbl.Type,
+			Fields:   map[string]interface{}{key: field},
+		}
+		if err := toml.UnmarshalTable(single, v); err != nil {
+			errs.add("", err)
+		}
+	}
+
+	if c.Strict {
+		errs.add("", unknown.err())
+		errs.add("", missingRequired(tbl, reflect.ValueOf(v)))
+	} else {
+		for _, err := range unknown {
+			log.Printf("W! [config] %s: %s, it is ignored", tbl.Name, err)
+		}
+	}
+	return errs.err()
+}
+
+// lookupField returns the struct field of t the key is decoded into, with
+// the matching rules of the toml package.
+func lookupField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+
+	norm := func(s string) string {
+		return strings.Replace(strings.ToLower(s), "_", "", -1)
+	}
+
+	var auto *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name := strings.TrimSpace(strings.SplitN(field.Tag.Get("toml"), ",", 2)[0])
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && name == "" {
+			if f, ok := lookupField(field.Type, key); ok {
+				return f, true
+			}
+			continue
+		}
+
+		switch {
+		case name == "-":
+		case name != "":
+			if name == key {
+				return field, true
+			}
+		case auto == nil && norm(field.Name) == norm(key):
+			auto = &field
+		}
+	}
+	if auto != nil {
+		return *auto, true
+	}
+	return reflect.StructField{}, false
+}
+
+// unknownKeys reports the unknown keys of the tables nested in the value
+// of the key.
+func unknownKeys(node interface{}, t reflect.Type, key string) error {
+	field, ok := lookupField(t, key)
+	if !ok {
+		return nil
+	}
+
+	ft := field.Type
+	var tables []*ast.Table
+	switch n := node.(type) {
+	case *ast.Table:
+		tables = []*ast.Table{n}
+	case []*ast.Table:
+		tables = n
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+	default:
+		return nil
+	}
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft.Kind() != reflect.Struct || ft == secretType {
+		// maps take any key, unmarshalers report their own errors
+		return nil
+	}
+
+	var errs Errors
+	for _, tbl := range tables {
+		for _, k := range sortedKeys(tbl.Fields) {
+			if _, ok := lookupField(ft, k); !ok {
+				errs.add("", fmt.Errorf("line %d: unknown key %q in %s", fieldLine(tbl.Fields[k]), k, key))
+				continue
+			}
+			errs.add(key, unknownKeys(tbl.Fields[k], ft, k))
+		}
+	}
+	return errs.err()
+}
+
+// missingRequired reports the fields tagged `required:"true"` that are
+// neither set in the table nor by the plugin defaults.
+func missingRequired(tbl *ast.Table, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("required") != "true" {
+			continue
+		}
+
+		key := strings.TrimSpace(strings.SplitN(field.Tag.Get("toml"), ",", 2)[0])
+		if key == "" {
+			key = field.Name
+		}
+		if _, ok := tbl.Fields[key]; ok {
+			continue
+		}
+		if !isZero(v.Field(i)) {
+			continue
+		}
+		errs.add("", fmt.Errorf("line %d: missing required key %q", tbl.Line, key))
+	}
+	return errs.err()
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// fieldLine returns the line a table field starts on.
+func fieldLine(field interface{}) int {
+	switch f := field.(type) {
+	case *ast.KeyValue:
+		return f.Line
+	case *ast.Table:
+		return f.Line
+	case []*ast.Table:
+		if len(f) > 0 {
+			return f[0].Line
+		}
+	}
+	return 0
+}
+
+// InitPlugins calls Init on every loaded plugin and reports all the errors,
+// prefixed with the plugin name.  The plugins are only initialized once,
+// later calls return the same result.
+func (c *Config) InitPlugins() error {
+	c.initOnce.Do(func() {
+		c.initErr = c.initPlugins()
+	})
+	return c.initErr
+}
+
+func (c *Config) initPlugins() error {
+	var errs Errors
+	for _, p := range c.AllPipelines() {
+		for _, input := range p.Inputs {
+			errs.add(input.LogName(), input.Init())
+		}
+		for _, processor := range p.Processors {
+			errs.add(processor.LogName(), processor.Init())
+		}
+		for _, aggregator := range p.Aggregators {
+			errs.add(aggregator.LogName(), aggregator.Init())
+		}
+		for _, processor := range p.AggProcessors {
+			errs.add(processor.LogName(), processor.Init())
+		}
+		for _, output := range p.Outputs {
+			errs.add(output.LogName(), output.Init())
+		}
+	}
+	return errs.err()
+}
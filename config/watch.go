@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is the quiet period after the last file event before a
+// change is signaled, editors usually write a file in several steps.
+const watchDebounce = 500 * time.Millisecond
+
+// WatchRemote polls the remote configs loaded into c every interval and
+// signals changed each time the content of one of them differs from the
+// content last seen. It returns when ctx is done.
+func (c *Config) WatchRemote(ctx context.Context, interval time.Duration, changed chan<- struct{}) {
+	if len(c.remoteHashes) == 0 || interval <= 0 {
+		return
+	}
+
+	hashes := make(map[string][sha256.Size]byte, len(c.remoteHashes))
+	for config, hash := range c.remoteHashes {
+		hashes[config] = hash
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for config, hash := range hashes {
+			u, _ := configURL(config)
+			data, err := fetchConfig(ctx, u)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("E! Error polling remote config: %s", err)
+				continue
+			}
+			if sum := sha256.Sum256(data); sum != hash {
+				log.Printf("I! Remote config %s changed", config)
+				hashes[config] = sum
+				notify(changed)
+			}
+		}
+	}
+}
+
+// WatchFiles watches the local config files and directories loaded into c
+// and signals changed when one of them is written, created or removed. It
+// returns when ctx is done.
+func (c *Config) WatchFiles(ctx context.Context, changed chan<- struct{}) error {
+	if len(c.localFiles) == 0 && len(c.localDirs) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the parent directories, files replaced by editors would
+	// otherwise drop out of the watch.
+	files := make(map[string]bool, len(c.localFiles))
+	dirs := make(map[string]bool, len(c.localDirs))
+	for _, file := range c.localFiles {
+		files[file] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return err
+		}
+	}
+	for _, dir := range c.localDirs {
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			log.Printf("E! Error watching config files: %s", err)
+		case event := <-watcher.Events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			name := filepath.Clean(event.Name)
+			if files[name] ||
+				(dirs[filepath.Dir(name)] && isConfigFile(name)) {
+				log.Printf("D! Config file %s changed", name)
+				debounce.Reset(watchDebounce)
+			}
+		case <-debounce.C:
+			notify(changed)
+		}
+	}
+}
+
+// notify signals changed without blocking, a pending signal already covers
+// the new change.
+func notify(changed chan<- struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
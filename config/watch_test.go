@@ -0,0 +1,204 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// configServer serves a config, failing the first failures requests with
+// status.
+type configServer struct {
+	sync.Mutex
+	body     string
+	token    string
+	status   int
+	failures int
+	requests int
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests++
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(s.status)
+		return
+	}
+	w.Write([]byte(s.body))
+}
+
+func (s *configServer) setBody(body string) {
+	s.Lock()
+	defer s.Unlock()
+	s.body = body
+}
+
+func (s *configServer) fail(status int, failures int) {
+	s.Lock()
+	defer s.Unlock()
+	s.status, s.failures = status, failures
+}
+
+// setFetchRetry shortens the remote config retries for a test.
+func setFetchRetry(t *testing.T, interval time.Duration) {
+	t.Helper()
+	saved := fetchConfigRetryInterval
+	fetchConfigRetryInterval = interval
+	t.Cleanup(func() { fetchConfigRetryInterval = saved })
+}
+
+func setConfigToken(t *testing.T, token string) {
+	t.Helper()
+	setEnv(t, configTokenEnv, token)
+}
+
+const remoteConfig = `
+[[inputs.simple]]
+  tip = "remote"
+`
+
+func TestLoadRemoteConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string // token the server requires
+		envToken string // token in the environment
+		status   int
+		failures int
+		requests int
+		wantErr  string
+	}{
+		{name: "plain", requests: 1},
+		{name: "bearer token", token: "secret", envToken: "secret", requests: 1},
+		{name: "missing token", token: "secret", requests: 1, wantErr: "401 Unauthorized"},
+		{name: "retried", status: http.StatusServiceUnavailable, failures: 2, requests: 3},
+		{name: "retries exhausted", status: http.StatusServiceUnavailable, failures: 10,
+			requests: fetchConfigRetries + 1, wantErr: "after 3 retries"},
+		{name: "not retried", status: http.StatusNotFound, failures: 1, requests: 1,
+			wantErr: "404 Not Found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFetchRetry(t, time.Millisecond)
+			setConfigToken(t, tt.envToken)
+
+			server := &configServer{body: remoteConfig, token: tt.token}
+			server.fail(tt.status, tt.failures)
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			c := NewConfig()
+			err := c.LoadConfig(ts.URL)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfig() error = %v", err)
+				}
+				if len(c.Inputs) != 1 {
+					t.Errorf("got %d inputs, want 1", len(c.Inputs))
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if server.requests != tt.requests {
+				t.Errorf("server got %d requests, want %d", server.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestWatchRemote(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(s *configServer)
+		changed bool
+	}{
+		{name: "unchanged", update: func(s *configServer) {}, changed: false},
+		{name: "changed", update: func(s *configServer) {
+			s.setBody(remoteConfig + "[[outputs.simpleoutput]]\n")
+		}, changed: true},
+		{name: "changed after a failed poll", update: func(s *configServer) {
+			s.fail(http.StatusBadGateway, 1)
+			s.setBody(remoteConfig + "[[outputs.simpleoutput]]\n")
+		}, changed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFetchRetry(t, time.Millisecond)
+			setConfigToken(t, "secret")
+
+			server := &configServer{body: remoteConfig, token: "secret"}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			c := NewConfig()
+			if err := c.LoadConfig(ts.URL); err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			changed := make(chan struct{}, 1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				c.WatchRemote(ctx, 10*time.Millisecond, changed)
+			}()
+
+			tt.update(server)
+			select {
+			case <-changed:
+				if !tt.changed {
+					t.Error("change signaled for an unchanged config")
+				}
+			case <-time.After(300 * time.Millisecond):
+				if tt.changed {
+					t.Error("change not signaled")
+				}
+			}
+
+			cancel()
+			<-done
+		})
+	}
+}
+
+func TestWatchRemoteStopsDuringRetry(t *testing.T) {
+	setFetchRetry(t, time.Hour)
+	setConfigToken(t, "")
+
+	server := &configServer{body: remoteConfig}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := NewConfig()
+	if err := c.LoadConfig(ts.URL); err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	server.fail(http.StatusServiceUnavailable, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.WatchRemote(ctx, time.Millisecond, make(chan struct{}, 1))
+	}()
+
+	// wait for the poll to fail and start waiting for its retry
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchRemote did not return once the context was done")
+	}
+}
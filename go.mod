@@ -3,8 +3,10 @@ module ezreal.com.cn/pip
 go 1.14
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/influxdata/telegraf v1.16.1
 	github.com/influxdata/toml v0.0.0-20190415235208-270119a8ce65
 	github.com/spf13/cobra v1.1.1
 	github.com/spf13/viper v1.7.1
+	gopkg.in/yaml.v2 v2.2.8
 )
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that can be unmarshalled from TOML strings such
+// as "10s" or from bare integers and floats interpreted as seconds.
+type Duration struct {
+	Duration time.Duration
+}
+
+// UnmarshalTOML parses the duration from the TOML config file
+func (d *Duration) UnmarshalTOML(b []byte) error {
+	var err error
+	b = trimQuotes(b)
+
+	// see if we can directly convert it
+	d.Duration, err = time.ParseDuration(string(b))
+	if err == nil {
+		return nil
+	}
+
+	// First try parsing as integer seconds
+	sI, err := strconv.ParseInt(string(b), 10, 64)
+	if err == nil {
+		d.Duration = time.Second * time.Duration(sI)
+		return nil
+	}
+	// Second try parsing as float seconds
+	sF, err := strconv.ParseFloat(string(b), 64)
+	if err == nil {
+		d.Duration = time.Duration(sF * float64(time.Second))
+		return nil
+	}
+
+	return err
+}
+
+// Size is a number of bytes that can be unmarshalled from TOML integers or
+// from strings with a unit such as "512MB" or "1GiB".
+type Size struct {
+	Size int64
+}
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// UnmarshalTOML parses the size from the TOML config file
+func (s *Size) UnmarshalTOML(b []byte) error {
+	str := strings.TrimSpace(string(trimQuotes(b)))
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(str)
+	}
+
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(str[i:]))]
+	if !ok {
+		return fmt.Errorf("invalid size %q, unknown unit %q", str, str[i:])
+	}
+	n, err := strconv.ParseFloat(str[:i], 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", str)
+	}
+	s.Size = int64(n * float64(unit))
+	return nil
+}
+
+func trimQuotes(b []byte) []byte {
+	s := strings.Trim(string(b), `"'`)
+	return []byte(s)
+}
+
+// RandomDuration returns a random duration between 0 and max.
+func RandomDuration(max time.Duration) time.Duration {
+	if max == 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(max.Nanoseconds()))
+}
+
+// SleepContext sleeps until the context is closed or the duration is reached.
+func SleepContext(ctx context.Context, duration time.Duration) error {
+	if duration == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(duration)
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
+
+// AlignDuration returns the duration until next aligned interval.
+// If the current time is aligned a 0 duration is returned.
+func AlignDuration(tm time.Time, interval time.Duration) time.Duration {
+	return AlignTime(tm, interval).Sub(tm)
+}
+
+// AlignTime returns the time of the next aligned interval.
+// If the current time is aligned the current time is returned.
+func AlignTime(tm time.Time, interval time.Duration) time.Time {
+	truncated := tm.Truncate(interval)
+	if truncated == tm {
+		return tm
+	}
+	return truncated.Add(interval)
+}
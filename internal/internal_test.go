@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshalTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "duration string", input: `"10s"`, want: 10 * time.Second},
+		{name: "single quoted", input: `'1m30s'`, want: 90 * time.Second},
+		{name: "integer seconds", input: `15`, want: 15 * time.Second},
+		{name: "float seconds", input: `0.5`, want: 500 * time.Millisecond},
+		{name: "float seconds above one", input: `1.25`, want: 1250 * time.Millisecond},
+		{name: "invalid", input: `"soon"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Duration
+			err := d.UnmarshalTOML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalTOML(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && d.Duration != tt.want {
+				t.Errorf("UnmarshalTOML(%s) = %s, want %s", tt.input, d.Duration, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignDuration(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		tm       time.Time
+		interval time.Duration
+		want     time.Duration
+	}{
+		{name: "aligned", tm: base, interval: 10 * time.Second, want: 0},
+		{name: "one second after", tm: base.Add(time.Second), interval: 10 * time.Second, want: 9 * time.Second},
+		{name: "just before", tm: base.Add(59 * time.Second), interval: time.Minute, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AlignDuration(tt.tm, tt.interval); got != tt.want {
+				t.Errorf("AlignDuration() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeUnmarshalTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "integer bytes", input: `1024`, want: 1024},
+		{name: "bytes unit", input: `"512B"`, want: 512},
+		{name: "decimal unit", input: `"10MB"`, want: 10 * 1000 * 1000},
+		{name: "binary unit", input: `"1GiB"`, want: 1 << 30},
+		{name: "fraction with space", input: `"1.5 KiB"`, want: 1536},
+		{name: "lower case", input: `'2kb'`, want: 2000},
+		{name: "unknown unit", input: `"10TB"`, wantErr: true},
+		{name: "no number", input: `"MB"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Size
+			err := s.UnmarshalTOML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalTOML(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && s.Size != tt.want {
+				t.Errorf("UnmarshalTOML(%s) = %d, want %d", tt.input, s.Size, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+// Package wal implements a write-ahead log of opaque records stored in
+// segmented append-only files.
+//
+// Every record is written with its length and a CRC-32 checksum, damaged or
+// partially written records found when the log is opened are cut off.  The
+// position of the first live record is kept in a checkpoint file so records
+// removed with TruncateFront are not read again after a restart.  Record
+// indexes are only valid for the lifetime of an opened Log.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultSegmentSize is the size at which a new segment file is started.
+	DefaultSegmentSize = 8 * 1024 * 1024
+
+	segmentExt     = ".seg"
+	checkpointFile = "checkpoint"
+	headerSize     = 8
+)
+
+var (
+	// ErrClosed is returned when using a closed log.
+	ErrClosed = errors.New("wal: log is closed")
+
+	// ErrOutOfRange is returned when reading an index that is not in the log.
+	ErrOutOfRange = errors.New("wal: index out of range")
+
+	// ErrCorrupt is returned when a record does not match its checksum.
+	ErrCorrupt = errors.New("wal: corrupt record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Options of a Log.
+type Options struct {
+	// SegmentSize is the size at which a new segment file is started,
+	// DefaultSegmentSize when zero.
+	SegmentSize int64
+
+	// MaxSize is the maximum size of the segment files, the oldest segments
+	// are removed once it is exceeded.  Zero means no limit.
+	MaxSize int64
+}
+
+// Log is a write-ahead log, it is safe to use from a single goroutine only.
+type Log struct {
+	dir  string
+	opts Options
+
+	segments []*segment
+	first    uint64 // index of the first live record
+	last     uint64 // index after the last record
+	size     int64  // total size of the segment files
+	repaired int64  // bytes cut off damaged segments on open
+
+	nextID uint64   // id of the next segment file
+	file   *os.File // last segment, opened for appending
+	reader *os.File // segment read last
+	readID uint64
+	closed bool
+}
+
+type segment struct {
+	id      uint64
+	path    string
+	index   uint64  // index of the first record
+	offsets []int64 // offset of each record in the file
+	size    int64
+}
+
+// end returns the index after the last record of the segment.
+func (s *segment) end() uint64 {
+	return s.index + uint64(len(s.offsets))
+}
+
+// Open opens the log stored in dir, creating the directory if needed.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, opts: opts}
+	if err := l.load(); err != nil {
+		l.closeFiles()
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the segments and the checkpoint of the log directory.
+func (l *Log) load() error {
+	entries, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	ckID, ckRecord, err := l.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		seg := &segment{id: id, path: l.segmentPath(id), index: l.last}
+		if err := l.scan(seg); err != nil {
+			return err
+		}
+
+		switch {
+		case id < ckID:
+			// fully consumed before the checkpoint was written
+			os.Remove(seg.path)
+			continue
+		case id == ckID:
+			skip := ckRecord
+			if skip > uint64(len(seg.offsets)) {
+				skip = uint64(len(seg.offsets))
+			}
+			l.first = l.last + skip
+		}
+
+		l.segments = append(l.segments, seg)
+		l.size += seg.size
+		l.last = seg.end()
+	}
+
+	// new segments must sort after the checkpoint, even when the segment it
+	// refers to is gone
+	l.nextID = ckID + 1
+	if n := len(ids); n > 0 && ids[n-1] >= ckID {
+		l.nextID = ids[n-1] + 1
+	}
+
+	if len(l.segments) == 0 {
+		return l.rotate()
+	}
+	last := l.segments[len(l.segments)-1]
+	l.file, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0600)
+	return err
+}
+
+// scan indexes the records of the segment, cutting the file at the first
+// damaged record.
+func (l *Log) scan(seg *segment) error {
+	data, err := ioutil.ReadFile(seg.path)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for offset < int64(len(data)) {
+		n, ok := checkRecord(data[offset:])
+		if !ok {
+			break
+		}
+		seg.offsets = append(seg.offsets, offset)
+		offset += headerSize + n
+	}
+
+	if offset < int64(len(data)) {
+		l.repaired += int64(len(data)) - offset
+		if err := os.Truncate(seg.path, offset); err != nil {
+			return err
+		}
+	}
+	seg.size = offset
+	return nil
+}
+
+// checkRecord returns the payload length of the record at the start of data
+// and whether it is complete and matches its checksum.
+func checkRecord(data []byte) (int64, bool) {
+	if len(data) < headerSize {
+		return 0, false
+	}
+	n := int64(binary.BigEndian.Uint32(data[0:4]))
+	sum := binary.BigEndian.Uint32(data[4:8])
+	if int64(len(data)) < headerSize+n {
+		return 0, false
+	}
+	return n, crc32.Checksum(data[headerSize:headerSize+n], crcTable) == sum
+}
+
+// First returns the index of the first record.
+func (l *Log) First() uint64 {
+	return l.first
+}
+
+// Last returns the index after the last record.
+func (l *Log) Last() uint64 {
+	return l.last
+}
+
+// Len returns the number of records in the log.
+func (l *Log) Len() int {
+	return int(l.last - l.first)
+}
+
+// Size returns the size of the segment files.
+func (l *Log) Size() int64 {
+	return l.size
+}
+
+// Repaired returns the number of damaged bytes removed when opening the log.
+func (l *Log) Repaired() int64 {
+	return l.repaired
+}
+
+// Append writes a record to the end of the log and returns its index.  The
+// oldest segments are removed when the log grows over its maximum size.
+func (l *Log) Append(data []byte) (uint64, error) {
+	if l.closed {
+		return 0, ErrClosed
+	}
+
+	seg := l.segments[len(l.segments)-1]
+	if seg.size >= l.opts.SegmentSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+		seg = l.segments[len(l.segments)-1]
+	}
+
+	record := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(data, crcTable))
+	copy(record[headerSize:], data)
+
+	if _, err := l.file.Write(record); err != nil {
+		// drop what may have been written of the record
+		l.file.Truncate(seg.size)
+		return 0, err
+	}
+
+	index := l.last
+	seg.offsets = append(seg.offsets, seg.size)
+	seg.size += int64(len(record))
+	l.size += int64(len(record))
+	l.last++
+
+	if l.opts.MaxSize > 0 {
+		for l.size > l.opts.MaxSize && len(l.segments) > 1 {
+			if l.first < l.segments[0].end() {
+				l.first = l.segments[0].end()
+			}
+			if err := l.removeFront(); err != nil {
+				return index, err
+			}
+		}
+	}
+	return index, nil
+}
+
+// Read returns the record stored at index.
+func (l *Log) Read(index uint64) ([]byte, error) {
+	if l.closed {
+		return nil, ErrClosed
+	}
+	if index < l.first || index >= l.last {
+		return nil, ErrOutOfRange
+	}
+
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].end() > index
+	})
+	seg := l.segments[i]
+	offset := seg.offsets[index-seg.index]
+	end := seg.size
+	if index+1 < seg.end() {
+		end = seg.offsets[index+1-seg.index]
+	}
+
+	if l.reader == nil || l.readID != seg.id {
+		if l.reader != nil {
+			l.reader.Close()
+			l.reader = nil
+		}
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		l.reader, l.readID = f, seg.id
+	}
+
+	record := make([]byte, end-offset)
+	if _, err := l.reader.ReadAt(record, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if _, ok := checkRecord(record); !ok {
+		return nil, fmt.Errorf("%w at index %d of %s", ErrCorrupt, index, seg.path)
+	}
+	return record[headerSize:], nil
+}
+
+// TruncateFront removes the records before index from the log.
+func (l *Log) TruncateFront(index uint64) error {
+	if l.closed {
+		return ErrClosed
+	}
+	if index > l.last {
+		return ErrOutOfRange
+	}
+	if index <= l.first {
+		return nil
+	}
+
+	l.first = index
+	for len(l.segments) > 1 && l.segments[0].end() <= l.first {
+		if err := l.removeFront(); err != nil {
+			return err
+		}
+	}
+	return l.writeCheckpoint()
+}
+
+// Sync commits the last segment to stable storage.
+func (l *Log) Sync() error {
+	if l.closed {
+		return ErrClosed
+	}
+	return l.file.Sync()
+}
+
+// Close syncs and closes the log, its files are removed when it is empty.
+func (l *Log) Close() error {
+	if l.closed {
+		return nil
+	}
+
+	err := l.file.Sync()
+	l.closeFiles()
+	l.closed = true
+
+	if l.first == l.last {
+		for _, seg := range l.segments {
+			os.Remove(seg.path)
+		}
+		os.Remove(filepath.Join(l.dir, checkpointFile))
+	}
+	return err
+}
+
+func (l *Log) closeFiles() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	if l.reader != nil {
+		l.reader.Close()
+		l.reader = nil
+	}
+}
+
+// rotate syncs the last segment and starts a new one.
+func (l *Log) rotate() error {
+	id := l.nextID
+	l.nextID++
+
+	if l.file != nil {
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+		l.file.Close()
+		l.file = nil
+	}
+
+	seg := &segment{id: id, path: l.segmentPath(id), index: l.last}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.segments = append(l.segments, seg)
+	return nil
+}
+
+// removeFront deletes the oldest segment file, it must not be the last one.
+func (l *Log) removeFront() error {
+	seg := l.segments[0]
+	if l.reader != nil && l.readID == seg.id {
+		l.reader.Close()
+		l.reader = nil
+	}
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	l.segments = l.segments[1:]
+	l.size -= seg.size
+	return l.writeCheckpoint()
+}
+
+// writeCheckpoint records the position of the first record as a segment id
+// and record number so it can be found again after a restart.
+func (l *Log) writeCheckpoint() error {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].end() > l.first
+	})
+	if i == len(l.segments) {
+		i--
+	}
+	seg := l.segments[i]
+
+	var buf [20]byte
+	binary.BigEndian.PutUint64(buf[0:8], seg.id)
+	binary.BigEndian.PutUint64(buf[8:16], l.first-seg.index)
+	binary.BigEndian.PutUint32(buf[16:20], crc32.Checksum(buf[:16], crcTable))
+
+	path := filepath.Join(l.dir, checkpointFile)
+	if err := ioutil.WriteFile(path+".tmp", buf[:], 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// readCheckpoint returns the segment id and record number of the first
+// record, zero when no checkpoint was written.
+func (l *Log) readCheckpoint() (uint64, uint64, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(l.dir, checkpointFile))
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(buf) != 20 || crc32.Checksum(buf[:16], crcTable) != binary.BigEndian.Uint32(buf[16:20]) {
+		return 0, 0, fmt.Errorf("%w: checkpoint of %s", ErrCorrupt, l.dir)
+	}
+	return binary.BigEndian.Uint64(buf[0:8]), binary.BigEndian.Uint64(buf[8:16]), nil
+}
+
+func (l *Log) segmentPath(id uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
@@ -0,0 +1,260 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func openLog(t *testing.T, dir string, opts Options) *Log {
+	t.Helper()
+	l, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return l
+}
+
+func appendRecords(t *testing.T, l *Log, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if _, err := l.Append([]byte(fmt.Sprintf("record-%03d", i))); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+}
+
+// records returns the payloads of the live records.
+func records(t *testing.T, l *Log) []string {
+	t.Helper()
+	var out []string
+	for i := l.First(); i < l.Last(); i++ {
+		data, err := l.Read(i)
+		if err != nil {
+			t.Fatalf("Read(%d) error = %v", i, err)
+		}
+		out = append(out, string(data))
+	}
+	return out
+}
+
+func recordNames(from, to int) []string {
+	var out []string
+	for i := from; i < to; i++ {
+		out = append(out, fmt.Sprintf("record-%03d", i))
+	}
+	return out
+}
+
+// lastSegment returns the path of the newest segment file.
+func lastSegment(t *testing.T, dir string) string {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(files) == 0 {
+		t.Fatal("no segment files")
+	}
+	return files[len(files)-1]
+}
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name     string
+		damage   func(t *testing.T, path string) // simulates the crash
+		want     []string
+		repaired bool
+	}{
+		{
+			name:   "clean shutdown",
+			damage: func(t *testing.T, path string) {},
+			want:   recordNames(0, 10),
+		},
+		{
+			name: "partially written record",
+			damage: func(t *testing.T, path string) {
+				info, _ := os.Stat(path)
+				os.Truncate(path, info.Size()-3)
+			},
+			want:     recordNames(0, 9),
+			repaired: true,
+		},
+		{
+			name: "partially written header",
+			damage: func(t *testing.T, path string) {
+				f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+				f.Write([]byte{0, 0, 0})
+				f.Close()
+			},
+			want:     recordNames(0, 10),
+			repaired: true,
+		},
+		{
+			name: "corrupted last record",
+			damage: func(t *testing.T, path string) {
+				f, _ := os.OpenFile(path, os.O_WRONLY, 0600)
+				info, _ := f.Stat()
+				f.WriteAt([]byte("X"), info.Size()-1)
+				f.Close()
+			},
+			want:     recordNames(0, 9),
+			repaired: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			l := openLog(t, dir, Options{})
+			appendRecords(t, l, 0, 10)
+			// a crash leaves the files as they are, without Close
+			l.closeFiles()
+
+			tt.damage(t, lastSegment(t, dir))
+
+			l = openLog(t, dir, Options{})
+			defer l.Close()
+			if got := records(t, l); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recovered %v, want %v", got, tt.want)
+			}
+			if (l.Repaired() > 0) != tt.repaired {
+				t.Errorf("Repaired() = %d, want repaired %v", l.Repaired(), tt.repaired)
+			}
+
+			// the log is appendable after the repair
+			appendRecords(t, l, 100, 101)
+			got := records(t, l)
+			if got[len(got)-1] != "record-100" {
+				t.Errorf("last record %q after repair, want record-100", got[len(got)-1])
+			}
+		})
+	}
+}
+
+func TestTruncateFrontCheckpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		segmentSize int64
+		truncate    uint64
+	}{
+		{name: "within a segment", segmentSize: DefaultSegmentSize, truncate: 4},
+		{name: "across segments", segmentSize: 40, truncate: 7},
+		{name: "everything", segmentSize: 40, truncate: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			opts := Options{SegmentSize: tt.segmentSize}
+			l := openLog(t, dir, opts)
+			appendRecords(t, l, 0, 10)
+			if err := l.TruncateFront(tt.truncate); err != nil {
+				t.Fatalf("TruncateFront() error = %v", err)
+			}
+			want := recordNames(int(tt.truncate), 10)
+			if got := records(t, l); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			l.closeFiles()
+
+			// truncated records are not read again after a restart
+			l = openLog(t, dir, opts)
+			if got := records(t, l); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v after reopening, want %v", got, want)
+			}
+			appendRecords(t, l, 10, 12)
+			want = append(want, recordNames(10, 12)...)
+			if got := records(t, l); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v after appending, want %v", got, want)
+			}
+			l.Close()
+		})
+	}
+}
+
+func TestTruncateFrontOutOfRange(t *testing.T) {
+	l := openLog(t, tempDir(t), Options{})
+	defer l.Close()
+	appendRecords(t, l, 0, 3)
+
+	if err := l.TruncateFront(4); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("TruncateFront() error = %v, want ErrOutOfRange", err)
+	}
+	if err := l.TruncateFront(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Read(1); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Read() of a truncated record error = %v, want ErrOutOfRange", err)
+	}
+}
+
+func TestMaxSizeDropsOldest(t *testing.T) {
+	dir := tempDir(t)
+	// each record takes 18 bytes, segments hold 3 records
+	opts := Options{SegmentSize: 50, MaxSize: 120}
+	l := openLog(t, dir, opts)
+	appendRecords(t, l, 0, 20)
+
+	if l.Size() > opts.MaxSize {
+		t.Errorf("Size() = %d, over the max size %d", l.Size(), opts.MaxSize)
+	}
+	got := records(t, l)
+	if len(got) == 0 || got[len(got)-1] != "record-019" {
+		t.Fatalf("newest records dropped: %v", got)
+	}
+	if got[0] == "record-000" {
+		t.Fatalf("oldest records kept: %v", got)
+	}
+	want := got
+	l.closeFiles()
+
+	l = openLog(t, dir, opts)
+	defer l.Close()
+	if got := records(t, l); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v after reopening, want %v", got, want)
+	}
+}
+
+func TestCloseRemovesEmptyLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		empty bool
+	}{
+		{name: "empty", empty: true},
+		{name: "not empty", empty: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tempDir(t)
+			l := openLog(t, dir, Options{})
+			appendRecords(t, l, 0, 3)
+			if tt.empty {
+				l.TruncateFront(l.Last())
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if _, err := l.Append(nil); err != ErrClosed {
+				t.Errorf("Append() after Close error = %v, want ErrClosed", err)
+			}
+
+			files, _ := ioutil.ReadDir(dir)
+			if tt.empty && len(files) != 0 {
+				t.Errorf("%d files left by an empty log", len(files))
+			}
+			if !tt.empty && len(files) == 0 {
+				t.Error("files of a log with records removed")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a log line, taken from the "D!", "I!", "W!" and
+// "E!" prefix of the message.
+type Level int
+
+// Log levels, ordered from the most to the least verbose.
+const (
+	_ Level = iota
+	DEBUG
+	INFO
+	WARN
+	ERROR
+	OFF
+)
+
+// logfile is the file currently logged to, nil when logging to stderr.
+var logfile *os.File
+
+var levels = map[byte]Level{
+	'D': DEBUG,
+	'I': INFO,
+	'W': WARN,
+	'E': ERROR,
+}
+
+// LogConfig contains the log configuration settings
+type LogConfig struct {
+	// will set the log level to DEBUG
+	Debug bool
+	// will set the log level to ERROR
+	Quiet bool
+	// Level is one of "debug", "info", "warn" or "error", it is used when
+	// neither Debug nor Quiet is set.
+	Level string
+	// will direct the logging output to a file. Empty string is
+	// interpreted as stderr. If there is an error opening the file the
+	// logger will fallback to stderr
+	Logfile string
+}
+
+// writer filters lines below its level and adds a timestamp to the lines it
+// lets through.
+type writer struct {
+	io.Writer
+	level Level
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	for i := 1; i < 10 && i < len(p); i++ {
+		if p[i] == '!' {
+			if l, ok := levels[p[i-1]]; ok && l < w.level {
+				return len(p), nil
+			}
+			break
+		}
+	}
+
+	ts := time.Now().UTC().Format(time.RFC3339)
+	if _, err := w.Writer.Write(append([]byte(ts+" "), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ParseLevel returns the Level named by s.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DEBUG, nil
+	case "", "info":
+		return INFO, nil
+	case "warn", "warning":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	case "off":
+		return OFF, nil
+	}
+	return INFO, fmt.Errorf("invalid log level %q", s)
+}
+
+// SetupLogging configures the standard logger: lines below the configured
+// level are dropped and the remaining ones are written, timestamped, to the
+// logfile or stderr.
+func SetupLogging(config LogConfig) error {
+	level, err := ParseLevel(config.Level)
+	if err != nil {
+		return err
+	}
+	if config.Debug {
+		level = DEBUG
+	}
+	if config.Quiet {
+		level = ERROR
+	}
+
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if config.Logfile != "" {
+		f, err := os.OpenFile(config.Logfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("E! Unable to open %s (%s), using stderr", config.Logfile, err)
+		} else {
+			out = f
+			file = f
+		}
+	}
+
+	log.SetFlags(0)
+	log.SetOutput(&writer{Writer: out, level: level})
+
+	// Logging is set up again when the config is reloaded, release the
+	// previous logfile.
+	if logfile != nil {
+		logfile.Close()
+	}
+	logfile = file
+	return nil
+}
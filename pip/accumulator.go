@@ -50,7 +50,7 @@ type Accumulator interface {
 	AddError(err error)
 
 	// Upgrade to a TrackingAccumulator with space for maxTracked
-	// metrics/batches.
+	// metrics/batches, a default is used when maxTracked is not positive.
 	WithTracking(maxTracked int) TrackingAccumulator
 }
 
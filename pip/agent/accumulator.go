@@ -8,6 +8,10 @@ import (
 	"ezreal.com.cn/pip/pip/metric"
 )
 
+// defaultMaxTracked is the number of metrics or groups a tracking accumulator
+// allows in flight when WithTracking is given a non-positive value.
+const defaultMaxTracked = 1000
+
 // MetricMaker ...
 type MetricMaker interface {
 	LogName() string
@@ -79,7 +83,7 @@ func (ac *accumulator) AddHistogram(
 }
 
 func (ac *accumulator) AddMetric(m pip.Metric) {
-	// m.SetTime(m.Time().Round(ac.precision))
+	m.SetTime(m.Time().Round(ac.precision))
 	if m := ac.maker.MakeMetric(m); m != nil {
 		ac.metrics <- m
 	}
@@ -127,5 +131,57 @@ func (ac *accumulator) getTime(t []time.Time) time.Time {
 }
 
 func (ac *accumulator) WithTracking(maxTracked int) pip.TrackingAccumulator {
-	return nil
+	if maxTracked <= 0 {
+		maxTracked = defaultMaxTracked
+	}
+	return &trackingAccumulator{
+		Accumulator: ac,
+		delivered:   make(chan pip.DeliveryInfo, maxTracked),
+		tracked:     make(chan struct{}, maxTracked),
+	}
+}
+
+// trackingAccumulator allows at most maxTracked metrics or groups to be in
+// flight; adding more blocks until a previous one has been delivered and its
+// info queued on Delivered.
+type trackingAccumulator struct {
+	pip.Accumulator
+	delivered chan pip.DeliveryInfo
+	tracked   chan struct{}
+}
+
+func (a *trackingAccumulator) AddTrackingMetric(m pip.Metric) pip.TrackingID {
+	a.tracked <- struct{}{}
+	dm, id := metric.WithTracking(m, a.onDelivery)
+	a.AddMetric(dm)
+	return id
+}
+
+func (a *trackingAccumulator) AddTrackingMetricGroup(group []pip.Metric) pip.TrackingID {
+	a.tracked <- struct{}{}
+	db, id := metric.WithGroupTracking(group, a.onDelivery)
+	for _, m := range db {
+		a.AddMetric(m)
+	}
+	return id
+}
+
+func (a *trackingAccumulator) Delivered() <-chan pip.DeliveryInfo {
+	return a.delivered
+}
+
+// onDelivery runs on the output that delivered the metric and must not block
+// it.  When the input is not draining Delivered the info is handed over in
+// the background, and its slot is only freed once the info has been queued,
+// so that it is the input adding more tracked metrics that waits.
+func (a *trackingAccumulator) onDelivery(info pip.DeliveryInfo) {
+	select {
+	case a.delivered <- info:
+		<-a.tracked
+	default:
+		go func() {
+			a.delivered <- info
+			<-a.tracked
+		}()
+	}
 }
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+	"ezreal.com.cn/pip/pip/models"
+)
+
+type testMaker struct{}
+
+func (m *testMaker) LogName() string                         { return "inputs.test" }
+func (m *testMaker) MakeMetric(metric pip.Metric) pip.Metric { return metric }
+func (m *testMaker) Log() pip.Logger                         { return models.NewLogger("", "inputs", "test", "") }
+
+func newTrackedMetric(t *testing.T) pip.Metric {
+	t.Helper()
+	m, err := metric.New("test", nil, map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTrackingAccumulatorMaxTracked(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxTracked int
+		inFlight   int // metrics that can be added before one is delivered
+	}{
+		{name: "negative uses the default", maxTracked: -1, inFlight: defaultMaxTracked},
+		{name: "zero uses the default", maxTracked: 0, inFlight: defaultMaxTracked},
+		{name: "explicit", maxTracked: 2, inFlight: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := make(chan pip.Metric, tt.inFlight+1)
+			acc := NewAccumulator(&testMaker{}, metrics).WithTracking(tt.maxTracked)
+
+			added := make(chan struct{})
+			go func() {
+				defer close(added)
+				for i := 0; i < tt.inFlight; i++ {
+					acc.AddTrackingMetric(newTrackedMetric(t))
+				}
+			}()
+			select {
+			case <-added:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("adding %d tracked metrics blocked", tt.inFlight)
+			}
+
+			// one more waits for a delivery
+			blocked := make(chan struct{})
+			go func() {
+				defer close(blocked)
+				acc.AddTrackingMetric(newTrackedMetric(t))
+			}()
+			select {
+			case <-blocked:
+				t.Fatal("added more tracked metrics than allowed in flight")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			(<-metrics).Accept()
+			select {
+			case info := <-acc.Delivered():
+				if !info.Delivered() {
+					t.Error("accepted metric reported as not delivered")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no delivery notification")
+			}
+			<-blocked
+		})
+	}
+}
+
+func TestTrackingAccumulatorUndrained(t *testing.T) {
+	const maxTracked = 2
+	metrics := make(chan pip.Metric, 3*maxTracked)
+	acc := NewAccumulator(&testMaker{}, metrics).WithTracking(maxTracked)
+
+	// the input never reads Delivered, the outputs must not wait for it
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		for i := 0; i < 2*maxTracked; i++ {
+			acc.AddTrackingMetric(newTrackedMetric(t))
+			(<-metrics).Accept()
+		}
+	}()
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivering blocked on an input not reading Delivered")
+	}
+
+	// the undrained deliveries hold the slots, so the input waits instead
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		acc.AddTrackingMetric(newTrackedMetric(t))
+	}()
+	select {
+	case <-blocked:
+		t.Fatal("added a tracked metric while the deliveries were not read")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// no delivery is lost once the input reads them
+	for i := 0; i < 2*maxTracked; i++ {
+		select {
+		case info := <-acc.Delivered():
+			if !info.Delivered() {
+				t.Error("accepted metric reported as not delivered")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d delivery notifications, want %d", i, 2*maxTracked)
+		}
+	}
+	<-blocked
+}
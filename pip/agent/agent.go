@@ -4,14 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"runtime"
 	"sync"
 	"time"
 
 	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/internal"
 	"ezreal.com.cn/pip/pip"
 	"ezreal.com.cn/pip/pip/models"
 )
 
+// maxConnectBackoff caps the wait between two output connection attempts.
+const maxConnectBackoff = 5 * time.Minute
+
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
@@ -48,183 +53,651 @@ type processorUnit struct {
 	src       <-chan pip.Metric
 	dst       chan<- pip.Metric
 	processor *models.RunningProcessor
+
+	// channel is the channel src receives from.
+	channel *models.Channel
+}
+
+// aggregatorUnit is a group of Aggregators and their source and sink channels.
+// Typically the aggregators write to a processor channel and pass the original
+// metrics to the output channel.  The sink channels may be the same channel.
+//
+//                            ┌────────────┐
+//                       ┌──▶ │ Aggregator │───┐
+//                       │    └────────────┘   │
+//  ______     ┌─────┐   │    ┌────────────┐   │     ______
+// ()_____)──▶ │ Fan │───┼──▶ │ Aggregator │───┼──▶ ()_____)
+//             └─────┘   │    └────────────┘   │
+//                       │    ┌────────────┐   │
+//                       └──▶ │ Aggregator │───┘
+//                            └────────────┘
+type aggregatorUnit struct {
+	src         <-chan pip.Metric
+	aggC        chan<- pip.Metric
+	outputC     chan<- pip.Metric
+	aggregators []*models.RunningAggregator
+
+	// channel is the channel src receives from.
+	channel *models.Channel
 }
 
 // outputUnit is a group of Outputs and their source channel.  pip.Metrics on the
-// channel are written to all outputs.
+// channel are copied to the queue of each output and added to the output by
+// its own worker, so a slow output does not hold up the others.
 //
-//                            ┌────────┐
-//                       ┌──▶ │ Output │
-//                       │    └────────┘
-//  ______     ┌─────┐   │    ┌────────┐
-// ()_____)──▶ │ Fan │───┼──▶ │ Output │
-//             └─────┘   │    └────────┘
-//                       │    ┌────────┐
-//                       └──▶ │ Output │
-//                            └────────┘
+//                            ______      ┌────────┐
+//                       ┌──▶ ()_____)──▶ │ Output │
+//                       │                └────────┘
+//  ______     ┌─────┐   │    ______      ┌────────┐
+// ()_____)──▶ │ Fan │───┼──▶ ()_____)──▶ │ Output │
+//             └─────┘   │                └────────┘
+//                       │    ______      ┌────────┐
+//                       └──▶ ()_____)──▶ │ Output │
+//                                        └────────┘
 type outputUnit struct {
 	src     <-chan pip.Metric
 	outputs []*models.RunningOutput
+
+	// channel is the channel src receives from.
+	channel *models.Channel
+
+	// queues holds the channel feeding each output, in the order of outputs.
+	queues []*models.Channel
+
+	// connecting tracks outputs still retrying Connect in the background,
+	// cancelConnect stops them.
+	connecting    sync.WaitGroup
+	cancelConnect context.CancelFunc
 }
 
-// Run starts and runs the Agent until the context is done.
+// Run starts and runs the Agent until the context is done.  Each pipeline of
+// the config runs on its own, a pipeline that fails does not stop the others
+// and Run returns the errors of all the pipelines that failed.
 func (a *Agent) Run(ctx context.Context) error {
 	err := a.initPlugins()
 	if err != nil {
 		return err
 	}
 
+	pipelines := a.Config.AllPipelines()
+	if len(pipelines) == 1 {
+		return a.runPipeline(ctx, pipelines[0])
+	}
+
+	errs := make([]error, len(pipelines))
+	var wg sync.WaitGroup
+	for i, p := range pipelines {
+		wg.Add(1)
+		go func(i int, p *config.Pipeline) {
+			defer wg.Done()
+			log.Printf("I! [agent] Starting pipeline %s", p.Name)
+			errs[i] = a.runPipeline(ctx, p)
+			if errs[i] != nil {
+				log.Printf("E! [agent] Error running pipeline %s: %v", p.Name, errs[i])
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	var failed config.Errors
+	for i, p := range pipelines {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("pipeline %s: %w", p.Name, errs[i]))
+		}
+	}
+	if len(failed) != 0 {
+		return failed
+	}
+	return nil
+}
+
+// runPipeline starts and runs the plugins of the pipeline until the context
+// is done.
+func (a *Agent) runPipeline(ctx context.Context, p *config.Pipeline) error {
 	startTime := time.Now()
-	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
+	next, ou, err := a.startOutputs(ctx, p, p.Outputs)
 	if err != nil {
 		return err
 	}
 
+	var apu []*processorUnit
+	var au *aggregatorUnit
 	var pu []*processorUnit
-	if len(a.Config.Processors) != 0 {
-		next, pu, err = a.startProcessors(next, a.Config.Processors)
-		if err != nil {
-			return err
+
+	// rollback stops the units started so far when a later one fails to
+	// start, from the inputs side down to the outputs.
+	rollback := func(err error) error {
+		a.stopProcessors(pu)
+		if au != nil {
+			au.channel.Stop()
 		}
+		a.stopProcessors(apu)
+		a.stopOutputs(ou)
+		return err
 	}
 
-	iu, err := a.startInputs(next, a.Config.Inputs)
-	if err != nil {
-		return err
+	if len(p.Aggregators) != 0 {
+		aggC := next
+		if len(p.AggProcessors) != 0 {
+			aggC, apu, err = a.startProcessors(next, p, p.AggProcessors, "aggprocessors")
+			if err != nil {
+				return rollback(err)
+			}
+		}
+
+		next, au, err = a.startAggregators(aggC, next, p, p.Aggregators)
+		if err != nil {
+			return rollback(err)
+		}
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err = a.runOutputs(ou)
+	if len(p.Processors) != 0 {
+		next, pu, err = a.startProcessors(next, p, p.Processors, "processors")
 		if err != nil {
-			log.Printf("E! [agent] Error running outputs: %v", err)
+			return rollback(err)
 		}
-	}()
+	}
 
-	if pu != nil {
+	iu, err := a.startInputs(next, p.Inputs)
+	if err != nil {
+		return rollback(err)
+	}
+
+	// each stage runs in its own goroutine, their errors are collected
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs config.Errors
+	run := func(stage string, f func() error) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err = a.runProcessors(pu)
-			if err != nil {
-				log.Printf("E! [agent] Error running processors: %v", err)
+			if err := f(); err != nil {
+				log.Printf("E! [agent] Error running %s: %v", stage, err)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
 			}
 		}()
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		err = a.runInputs(ctx, startTime, iu)
-		if err != nil {
-			log.Printf("E! [agent] Error running inputs: %v", err)
-		}
-	}()
+	run("outputs", func() error { return a.runOutputs(ou) })
+	if au != nil {
+		run("processors", func() error { return a.runProcessors(apu) })
+		run("aggregators", func() error { return a.runAggregators(startTime, au) })
+	}
+	if pu != nil {
+		run("processors", func() error { return a.runProcessors(pu) })
+	}
+	run("inputs", func() error { return a.runInputs(ctx, startTime, iu) })
 
 	wg.Wait()
+
+	log.Printf("D! [agent] Closing outputs")
+	a.closeOutputs(ou)
+
 	log.Printf("D! [agent] Stopped Successfully")
-	return err
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
 }
 
 // initPlugins runs the Init function on plugins.
 func (a *Agent) initPlugins() error {
-	for _, input := range a.Config.Inputs {
-		err := input.Init()
+	return a.Config.InitPlugins()
+}
+
+// startOutputs opens the buffer of all outputs, calls Connect on them and
+// returns the source channel.  If an error occurs opening a buffer or calling
+// Connect all started plugins have Close called.
+func (a *Agent) startOutputs(
+	ctx context.Context,
+	p *config.Pipeline,
+	outputs []*models.RunningOutput,
+) (chan<- pip.Metric, *outputUnit, error) {
+	src, err := a.newChannel(p, "outputs", "outputs")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// background connection attempts end with the run or when startup fails
+	connectCtx, cancel := context.WithCancel(ctx)
+	unit := &outputUnit{
+		src:           src.Out(),
+		channel:       src,
+		cancelConnect: cancel,
+	}
+
+	for _, output := range outputs {
+		if err := output.OpenBuffer(); err != nil {
+			a.stopOutputs(unit)
+			return nil, nil, fmt.Errorf("opening buffer of output %s: %w", output.LogName(), err)
+		}
+
+		err := a.connectOutput(connectCtx, unit, output)
 		if err != nil {
-			return err
+			output.Close()
+			a.stopOutputs(unit)
+			return nil, nil, fmt.Errorf("connecting output %s: %w", output.LogName(), err)
 		}
-	}
-	for _, processor := range a.Config.Processors {
-		err := processor.Init()
+
+		// the queue is named after the output so a spill log follows it
+		// when outputs are reordered
+		queue, err := a.newChannel(p, "outputs", "outputs-"+output.Config.ID())
 		if err != nil {
-			return err
+			output.Close()
+			a.stopOutputs(unit)
+			return nil, nil, err
 		}
+
+		unit.outputs = append(unit.outputs, output)
+		unit.queues = append(unit.queues, queue)
 	}
 
-	for _, output := range a.Config.Outputs {
-		err := output.Init()
-		if err != nil {
-			return err
+	return src.In(), unit, nil
+}
+
+// connectOutput connects the output, retrying with backoff on failure.
+//
+// With the "error" startup behavior a failure after all retries is returned
+// to the caller.  With the "retry" behavior the output is accepted right away
+// and Connect is retried in the background until it succeeds or the context
+// is done; metrics are kept in the output buffer in the meantime.
+func (a *Agent) connectOutput(
+	ctx context.Context,
+	unit *outputUnit,
+	output *models.RunningOutput,
+) error {
+	if output.Connected() {
+		// already connected by CheckOutputs
+		return nil
+	}
+
+	log.Printf("D! [agent] Attempting connection to [%s]", output.LogName())
+	err := output.Connect()
+	if err == nil {
+		log.Printf("D! [agent] Successfully connected to %s", output.LogName())
+		return nil
+	}
+
+	switch a.startupErrorBehavior(output) {
+	case models.StartupErrorRetry:
+		log.Printf("E! [agent] Failed to connect to [%s], retrying in the background, "+
+			"error was '%s'", output.LogName(), err)
+
+		unit.connecting.Add(1)
+		go func() {
+			defer unit.connecting.Done()
+			a.retryConnect(ctx, output, -1, err)
+		}()
+		return nil
+	default:
+		log.Printf("E! [agent] Failed to connect to [%s], retrying in %s, "+
+			"error was '%s'", output.LogName(), a.Config.Agent.OutputConnectRetryInterval.Duration, err)
+		return a.retryConnect(ctx, output, a.Config.Agent.OutputConnectRetries, err)
+	}
+}
+
+// startupErrorBehavior returns the startup error behavior of the output, the
+// agent one unless the output overrides it.
+func (a *Agent) startupErrorBehavior(output *models.RunningOutput) string {
+	if output.Config.StartupErrorBehavior != "" {
+		return output.Config.StartupErrorBehavior
+	}
+	return a.Config.Agent.OutputStartupErrorBehavior
+}
+
+// CheckOutputs connects the outputs that must connect at startup, so a config
+// can be checked before it replaces a running one.  The outputs are left
+// connected for Run, which does not connect them again.  If any output fails
+// to connect the others are closed and the errors of all failing outputs are
+// returned.
+func (a *Agent) CheckOutputs() error {
+	var errs config.Errors
+	var connected []*models.RunningOutput
+	for _, p := range a.Config.AllPipelines() {
+		for _, output := range p.Outputs {
+			if a.startupErrorBehavior(output) != models.StartupErrorError {
+				continue
+			}
+			if err := output.Connect(); err != nil {
+				errs = append(errs, fmt.Errorf("connecting output %s: %w", output.LogName(), err))
+				continue
+			}
+			connected = append(connected, output)
+		}
+	}
+	if len(errs) != 0 {
+		for _, output := range connected {
+			output.Close()
 		}
+		return errs
 	}
 	return nil
 }
 
-// startOutputs calls Connect on all outputs and returns the source channel.
-// If an error occurs calling Connect all stared plugins have Close called.
-func (a *Agent) startOutputs(
+// retryConnect calls Connect up to retries times, or until it succeeds if
+// retries is negative, doubling the wait between attempts.  The last
+// connection error is returned if all attempts fail.
+func (a *Agent) retryConnect(
 	ctx context.Context,
-	outputs []*models.RunningOutput,
-) (chan<- pip.Metric, *outputUnit, error) {
-	src := make(chan pip.Metric, 100)
+	output *models.RunningOutput,
+	retries int,
+	err error,
+) error {
+	backoff := a.Config.Agent.OutputConnectRetryInterval.Duration
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 0; retries < 0 || attempt < retries; attempt++ {
+		if err := internal.SleepContext(ctx, backoff); err != nil {
+			return err
+		}
+
+		err = output.Connect()
+		if err == nil {
+			log.Printf("D! [agent] Successfully connected to %s", output.LogName())
+			return nil
+		}
 
-	unit := &outputUnit{src: src, outputs: outputs}
-	return src, unit, nil
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+		log.Printf("E! [agent] Failed to connect to [%s], error was '%s'",
+			output.LogName(), err)
+	}
+	return err
+}
+
+// closeOutputs closes all outputs once any background connection attempts
+// have given up.
+func (a *Agent) closeOutputs(unit *outputUnit) {
+	unit.cancelConnect()
+	unit.connecting.Wait()
+	for _, output := range unit.outputs {
+		output.Close()
+	}
+}
+
+// stopOutputs undoes startOutputs when the pipeline fails to start: the
+// background connection attempts are cancelled, the outputs closed and their
+// channels stopped.
+func (a *Agent) stopOutputs(unit *outputUnit) {
+	unit.cancelConnect()
+	unit.connecting.Wait()
+	for i, output := range unit.outputs {
+		unit.queues[i].Stop()
+		output.Close()
+	}
+	unit.channel.Stop()
 }
 
 // startProcessors sets up the processor chain and calls Start on all
 // processors.  If an error occurs any started processors are Stopped.
 func (a *Agent) startProcessors(
 	dst chan<- pip.Metric,
+	p *config.Pipeline,
 	processors models.RunningProcessors,
+	chain string,
 ) (chan<- pip.Metric, []*processorUnit, error) {
 	var units []*processorUnit
-
-	var src chan pip.Metric
-	for _, processor := range processors {
-		src = make(chan pip.Metric, 100)
+	for i, processor := range processors {
+		src, err := a.newChannel(p, "processors", fmt.Sprintf("%s-%d", chain, i))
+		if err != nil {
+			a.stopProcessors(units)
+			return nil, nil, err
+		}
 		acc := NewAccumulator(processor, dst)
 
-		err := processor.Start(acc)
+		err = processor.Start(acc)
 		if err != nil {
-			for _, u := range units {
-				u.processor.Stop()
-				close(u.dst)
-			}
+			src.Stop()
+			a.stopProcessors(units)
 			return nil, nil, fmt.Errorf("starting processor %s: %w", processor.LogName(), err)
 		}
 
 		units = append(units, &processorUnit{
-			src:       src,
+			src:       src.Out(),
 			dst:       dst,
 			processor: processor,
+			channel:   src,
 		})
 
-		dst = src
+		dst = src.In()
 	}
 
-	return src, units, nil
+	return dst, units, nil
 }
 
+// stopProcessors undoes startProcessors when the pipeline fails to start, the
+// processors are Stopped and their channels stopped.
+func (a *Agent) stopProcessors(units []*processorUnit) {
+	for _, u := range units {
+		u.processor.Stop()
+		u.channel.Stop()
+	}
+}
+
+// startAggregators sets up the aggregator unit and returns the source channel.
+func (a *Agent) startAggregators(
+	aggC chan<- pip.Metric,
+	outputC chan<- pip.Metric,
+	p *config.Pipeline,
+	aggregators []*models.RunningAggregator,
+) (chan<- pip.Metric, *aggregatorUnit, error) {
+	src, err := a.newChannel(p, "aggregators", "aggregators")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unit := &aggregatorUnit{
+		src:         src.Out(),
+		aggC:        aggC,
+		outputC:     outputC,
+		aggregators: aggregators,
+		channel:     src,
+	}
+	return src.In(), unit, nil
+}
+
+// newChannel creates and starts the channel called name that feeds the
+// stage of the pipeline, using the capacity and overflow policy configured
+// for the stage.
+func (a *Agent) newChannel(p *config.Pipeline, stage string, name string) (*models.Channel, error) {
+	cc := p.Channel(a.Config.Agent, stage, name)
+	ch := models.NewChannel(cc)
+	if err := ch.Start(); err != nil {
+		return nil, fmt.Errorf("starting channel %s: %w", cc.Name, err)
+	}
+	return ch, nil
+}
+
+// startInputs calls Start on all ServiceInputs and returns the input unit.
+// If an error occurs any started ServiceInputs are Stopped.
 func (a *Agent) startInputs(
 	dst chan<- pip.Metric,
 	inputs []*models.RunningInput,
 ) (*inputUnit, error) {
+	log.Printf("D! [agent] Starting service inputs")
+
 	unit := &inputUnit{
-		dst:    dst,
-		inputs: inputs,
+		dst: dst,
 	}
+
+	for _, input := range inputs {
+		if si, ok := input.Input.(pip.ServiceInput); ok {
+			// The accumulator passed to Start may be retained by the plugin
+			// and used until Stop returns.
+			acc := NewAccumulator(input, dst)
+			acc.SetPrecision(getPrecision(a.Config.Agent.Precision.Duration,
+				a.Config.Agent.Interval.Duration))
+
+			err := si.Start(acc)
+			if err != nil {
+				stopServiceInputs(unit.inputs)
+				return nil, fmt.Errorf("starting input %s: %w", input.LogName(), err)
+			}
+		}
+		unit.inputs = append(unit.inputs, input)
+	}
+
 	return unit, nil
 }
 
+// stopServiceInputs stops all service inputs.
+func stopServiceInputs(inputs []*models.RunningInput) {
+	for _, input := range inputs {
+		if si, ok := input.Input.(pip.ServiceInput); ok {
+			si.Stop()
+		}
+	}
+}
+
 // runOutputs begins processing pip.metrics and returns until the source channel is
 // closed and all pip.metrics have been written.  On shutdown pip.metrics will be
 // written one last time and dropped if unsuccessful.
 func (a *Agent) runOutputs(
 	unit *outputUnit,
 ) error {
+	var wg sync.WaitGroup
+
+	// Start flush loop
+	interval := a.Config.Agent.FlushInterval.Duration
+	jitter := a.Config.Agent.FlushJitter.Duration
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for _, output := range unit.outputs {
+		interval := interval
+		// Overwrite agent flush_interval if this plugin has its own.
+		if output.Config.FlushInterval != 0 {
+			interval = output.Config.FlushInterval
+		}
+
+		jitter := jitter
+		// Overwrite agent flush_jitter if this plugin has its own.
+		if output.Config.FlushJitter != nil {
+			jitter = *output.Config.FlushJitter
+		}
+
+		wg.Add(1)
+		go func(output *models.RunningOutput) {
+			defer wg.Done()
+
+			ticker := NewRollingTicker(interval, jitter)
+			defer ticker.Stop()
+
+			a.flushLoop(ctx, output, ticker)
+		}(output)
+	}
+
+	// Start a worker per output adding the metrics of its queue
+	var workers sync.WaitGroup
+	for i, output := range unit.outputs {
+		workers.Add(1)
+		go func(output *models.RunningOutput, queue <-chan pip.Metric) {
+			defer workers.Done()
+
+			for metric := range queue {
+				output.AddMetric(metric)
+			}
+		}(output, unit.queues[i].Out())
+	}
+
 	for metric := range unit.src {
-		for _, output := range unit.outputs {
-			output.AddMetric(metric)
+		if len(unit.queues) == 0 {
+			metric.Drop()
+			continue
+		}
+
+		for i, queue := range unit.queues {
+			if i == len(unit.queues)-1 {
+				queue.In() <- metric
+			} else {
+				queue.In() <- metric.Copy()
+			}
 		}
 	}
 
+	for _, queue := range unit.queues {
+		close(queue.In())
+	}
+	workers.Wait()
+
 	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
+	cancel()
+	wg.Wait()
+
 	return nil
 }
 
+// flushLoop runs an output's flush function periodically until the context is
+// done.
+func (a *Agent) flushLoop(
+	ctx context.Context,
+	output *models.RunningOutput,
+	ticker Ticker,
+) {
+	logError := func(err error) {
+		if err != nil {
+			log.Printf("E! [agent] Error writing to %s: %v", output.LogName(), err)
+		}
+	}
+
+	for {
+		// Favor shutdown over other methods.
+		select {
+		case <-ctx.Done():
+			logError(a.flushOnce(output, ticker, output.Write))
+			return
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			logError(a.flushOnce(output, ticker, output.Write))
+			return
+		case <-ticker.Elapsed():
+			logError(a.flushOnce(output, ticker, output.Write))
+		case <-output.BatchReady:
+			// Favor the ticker over batch ready
+			select {
+			case <-ticker.Elapsed():
+				logError(a.flushOnce(output, ticker, output.Write))
+			default:
+				logError(a.flushOnce(output, ticker, output.WriteBatch))
+			}
+		}
+	}
+}
+
+// flushOnce runs the output's Write function once, logging a warning each
+// interval it fails to complete before.
+func (a *Agent) flushOnce(
+	output *models.RunningOutput,
+	ticker Ticker,
+	writeFunc func() error,
+) error {
+	done := make(chan error)
+	go func() {
+		done <- writeFunc()
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			output.LogBufferStatus()
+			return err
+		case <-ticker.Elapsed():
+			log.Printf("W! [agent] [%q] did not complete within its flush interval",
+				output.LogName())
+			output.LogBufferStatus()
+		}
+	}
+}
+
 // runProcessors begins processing pip.metrics and runs until the source channel is
 // closed and all pip.metrics have been written.
 func (a *Agent) runProcessors(
@@ -256,6 +729,105 @@ func (a *Agent) runProcessors(
 	return nil
 }
 
+// runAggregators beings aggregating metrics and runs until the source channel
+// is closed and all metrics have been written.
+func (a *Agent) runAggregators(
+	startTime time.Time,
+	unit *aggregatorUnit,
+) error {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Before calling Add, initialize the aggregation window.  This ensures
+	// that any metric created after start time will be aggregated.
+	for _, agg := range unit.aggregators {
+		since, until := updateWindow(startTime, a.Config.Agent.RoundInterval, agg.Period())
+		agg.UpdateWindow(since, until)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for metric := range unit.src {
+			var dropOriginal bool
+			for _, agg := range unit.aggregators {
+				if ok := agg.Add(metric); ok {
+					dropOriginal = true
+				}
+			}
+
+			if !dropOriginal {
+				unit.outputC <- metric // keep original.
+			} else {
+				metric.Drop()
+			}
+		}
+		cancel()
+	}()
+
+	for _, agg := range unit.aggregators {
+		wg.Add(1)
+		go func(agg *models.RunningAggregator) {
+			defer wg.Done()
+
+			acc := NewAccumulator(agg, unit.aggC)
+			a.push(ctx, agg, acc)
+		}(agg)
+	}
+
+	wg.Wait()
+
+	// In the case that there are no processors, both aggC and outputC are the
+	// same channel.  If there are processors, we close the aggC and the
+	// processor chain will close the outputC when it finishes processing.
+	close(unit.aggC)
+	log.Printf("D! [agent] Aggregator channel closed")
+
+	return nil
+}
+
+// updateWindow returns the first aggregation window starting at or before
+// start.
+func updateWindow(start time.Time, roundInterval bool, period time.Duration) (time.Time, time.Time) {
+	var until time.Time
+	if roundInterval {
+		until = internal.AlignTime(start, period)
+		if until == start {
+			until = internal.AlignTime(start.Add(time.Nanosecond), period)
+		}
+	} else {
+		until = start.Add(period)
+	}
+
+	since := until.Add(-period)
+
+	return since, until
+}
+
+// push runs the push for a single aggregator every period.
+func (a *Agent) push(
+	ctx context.Context,
+	aggregator *models.RunningAggregator,
+	acc pip.Accumulator,
+) {
+	for {
+		// Ensures that Push will be called for each period, even if it has
+		// already elapsed before this function is called.  This is guaranteed
+		// because so long as only Push updates the EndPeriod.  This method
+		// also avoids drift by not using a ticker.  The push waits for the
+		// delay so late metrics of the window are included.
+		until := time.Until(aggregator.EndPeriod().Add(aggregator.Config.Delay))
+
+		select {
+		case <-time.After(until):
+			aggregator.Push(acc)
+		case <-ctx.Done():
+			aggregator.Push(acc)
+			return
+		}
+	}
+}
+
 // runInputs starts and triggers the periodic gather for Inputs.
 //
 // When the context is done the timers are stopped and this function returns
@@ -265,14 +837,53 @@ func (a *Agent) runInputs(
 	startTime time.Time,
 	unit *inputUnit,
 ) error {
+	var wg sync.WaitGroup
 	for _, input := range unit.inputs {
-		acc := NewAccumulator(input, unit.dst)
+		// ServiceInputs push metrics through the accumulator given to Start,
+		// they are only gathered when an interval is set on the plugin.
+		if _, ok := input.Input.(pip.ServiceInput); ok && input.Config.Interval == 0 {
+			continue
+		}
+
+		// Overwrite agent interval if this plugin has its own.
+		interval := a.Config.Agent.Interval.Duration
+		if input.Config.Interval != 0 {
+			interval = input.Config.Interval
+		}
+
+		// Overwrite agent collection_jitter if this plugin has its own.
+		jitter := a.Config.Agent.CollectionJitter.Duration
+		if input.Config.CollectionJitter != 0 {
+			jitter = input.Config.CollectionJitter
+		}
 
-		for {
-			time.Sleep(3 * time.Second)
-			input.Input.Gather(acc)
+		var ticker Ticker
+		if a.Config.Agent.RoundInterval {
+			ticker = NewAlignedTicker(startTime, interval, jitter)
+		} else {
+			ticker = NewUnalignedTicker(interval, jitter)
 		}
+		defer ticker.Stop()
+
+		acc := NewAccumulator(input, unit.dst)
+		acc.SetPrecision(getPrecision(a.Config.Agent.Precision.Duration, interval))
+
+		wg.Add(1)
+		go func(input *models.RunningInput) {
+			defer wg.Done()
+			a.gatherLoop(ctx, acc, input, ticker, interval)
+		}(input)
 	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	log.Printf("D! [agent] Stopping service inputs")
+	stopServiceInputs(unit.inputs)
+
+	close(unit.dst)
+	log.Printf("D! [agent] Input channel closed")
+
 	return nil
 }
 
@@ -282,6 +893,82 @@ func (a *Agent) gatherLoop(
 	ctx context.Context,
 	acc pip.Accumulator,
 	input *models.RunningInput,
+	ticker Ticker,
+	interval time.Duration,
 ) {
+	defer panicRecover(input)
 
+	for {
+		select {
+		case <-ticker.Elapsed():
+			err := a.gatherOnce(acc, input, ticker, interval)
+			if err != nil {
+				acc.AddError(err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// gatherOnce runs the input's Gather function once, logging a warning each
+// interval it fails to complete before.
+func (a *Agent) gatherOnce(
+	acc pip.Accumulator,
+	input *models.RunningInput,
+	ticker Ticker,
+	interval time.Duration,
+) error {
+	done := make(chan error)
+	go func() {
+		done <- input.Gather(acc)
+	}()
+
+	// Only warn after interval seconds, even if the interval is started late.
+	// Intervals can start late if the previous interval went over or due to
+	// clock changes.
+	slowWarning := time.NewTicker(interval)
+	defer slowWarning.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-slowWarning.C:
+			log.Printf("W! [%s] Collection took longer than expected; not complete after interval of %s",
+				input.LogName(), interval)
+		case <-ticker.Elapsed():
+			log.Printf("D! [%s] Previous collection has not completed; scheduled collection skipped",
+				input.LogName())
+		}
+	}
+}
+
+// panicRecover displays an error if an input panics.
+func panicRecover(input *models.RunningInput) {
+	if err := recover(); err != nil {
+		trace := make([]byte, 2048)
+		runtime.Stack(trace, true)
+		log.Printf("E! FATAL: [%s] panicked: %s, Stack:\n%s",
+			input.LogName(), err, trace)
+	}
+}
+
+// getPrecision returns the rounding precision for metrics, the configured
+// precision when set, otherwise one derived from the collection interval.
+func getPrecision(precision, interval time.Duration) time.Duration {
+	if precision > 0 {
+		return precision
+	}
+
+	switch {
+	case interval >= time.Second:
+		return time.Second
+	case interval >= time.Millisecond:
+		return time.Millisecond
+	case interval >= time.Microsecond:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
 }
@@ -0,0 +1,348 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/internal"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/models"
+)
+
+type mockOutput struct {
+	connectErr error
+	connects   int32
+	closed     int32
+}
+
+func (o *mockOutput) Description() string              { return "mock output" }
+func (o *mockOutput) SampleConfig() string             { return "" }
+func (o *mockOutput) Write(metrics []pip.Metric) error { return nil }
+
+func (o *mockOutput) Connect() error {
+	atomic.AddInt32(&o.connects, 1)
+	return o.connectErr
+}
+
+func (o *mockOutput) Close() error {
+	atomic.AddInt32(&o.closed, 1)
+	return nil
+}
+
+type failingProcessor struct{}
+
+func (p *failingProcessor) Description() string                              { return "failing processor" }
+func (p *failingProcessor) SampleConfig() string                             { return "" }
+func (p *failingProcessor) Start(acc pip.Accumulator) error                  { return errors.New("start failed") }
+func (p *failingProcessor) Add(metric pip.Metric, acc pip.Accumulator) error { return nil }
+func (p *failingProcessor) Stop() error                                      { return nil }
+
+func newTestAgent() (*Agent, *config.Pipeline) {
+	c := config.NewConfig()
+	c.Agent.OutputConnectRetries = 0
+	c.Agent.OutputConnectRetryInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	return &Agent{Config: c}, c.Pipeline
+}
+
+func addOutput(p *config.Pipeline, name string, behavior string, output pip.Output) {
+	p.Outputs = append(p.Outputs, models.NewRunningOutput(output, &models.OutputConfig{
+		Name:                 name,
+		StartupErrorBehavior: behavior,
+	}, 0, 0))
+}
+
+func TestStartOutputsCancelsBackgroundRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []string // startup error behavior of each failing output
+	}{
+		{name: "retry then error", outputs: []string{models.StartupErrorRetry, models.StartupErrorError}},
+		{name: "two retries then error", outputs: []string{
+			models.StartupErrorRetry, models.StartupErrorRetry, models.StartupErrorError,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, p := newTestAgent()
+			for i, behavior := range tt.outputs {
+				addOutput(p, "output"+string(rune('a'+i)), behavior,
+					&mockOutput{connectErr: errors.New("connection refused")})
+			}
+
+			errC := make(chan error, 1)
+			go func() {
+				_, _, err := a.startOutputs(context.Background(), p, p.Outputs)
+				errC <- err
+			}()
+
+			select {
+			case err := <-errC:
+				if err == nil {
+					t.Fatal("startOutputs() succeeded, want a connection error")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("startOutputs() did not return, background retries were not cancelled")
+			}
+		})
+	}
+}
+
+func TestRunPipelineRollsBackOnStartError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, p := newTestAgent()
+	// spilling channels keep their log open until they are stopped
+	a.Config.Agent.BufferDirectory = dir
+	a.Config.Agent.OverflowPolicy = models.OverflowSpill
+
+	output := &mockOutput{}
+	addOutput(p, "mock", "", output)
+	p.Processors = append(p.Processors, models.NewRunningProcessor(&failingProcessor{},
+		&models.ProcessorConfig{Name: "failing"}))
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- a.runPipeline(context.Background(), p)
+	}()
+
+	select {
+	case err := <-errC:
+		if err == nil {
+			t.Fatal("runPipeline() succeeded, want the processor start error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipeline() did not return")
+	}
+
+	if n := atomic.LoadInt32(&output.closed); n != 1 {
+		t.Errorf("output closed %d times, want 1", n)
+	}
+
+	// a stopped channel closes its spill log, removing the empty files
+	files, _ := filepath.Glob(filepath.Join(dir, "channels", "*", "*"))
+	if len(files) != 0 {
+		t.Errorf("spill logs left open: %v", files)
+	}
+}
+
+type pushAggregator struct {
+	pushed chan time.Time
+}
+
+func (a *pushAggregator) Description() string      { return "push recorder" }
+func (a *pushAggregator) SampleConfig() string     { return "" }
+func (a *pushAggregator) Add(in pip.Metric)        {}
+func (a *pushAggregator) Push(acc pip.Accumulator) { a.pushed <- time.Now() }
+func (a *pushAggregator) Reset()                   {}
+
+func TestPushWaitsForDelay(t *testing.T) {
+	tests := []struct {
+		name  string
+		delay time.Duration
+	}{
+		{name: "no delay", delay: 0},
+		{name: "delay", delay: 150 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAgent()
+			agg := &pushAggregator{pushed: make(chan time.Time, 10)}
+			ra := models.NewRunningAggregator(agg, &models.AggregatorConfig{
+				Name:   "push",
+				Period: time.Second,
+				Delay:  tt.delay,
+			})
+			end := time.Now().Add(50 * time.Millisecond)
+			ra.UpdateWindow(end.Add(-time.Second), end)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				a.push(ctx, ra, NewAccumulator(ra, make(chan pip.Metric, 10)))
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			select {
+			case pushed := <-agg.pushed:
+				if want := end.Add(tt.delay); pushed.Before(want) {
+					t.Errorf("pushed at %s, %s before the end of the window plus delay",
+						pushed.Format(time.StampMicro), want.Sub(pushed))
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("aggregator was not pushed")
+			}
+		})
+	}
+}
+
+func TestUpdateWindow(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		start         time.Time
+		roundInterval bool
+		period        time.Duration
+		since         time.Time
+		until         time.Time
+	}{
+		{
+			name:   "not rounded",
+			start:  base.Add(7 * time.Second),
+			period: 30 * time.Second,
+			since:  base.Add(7 * time.Second),
+			until:  base.Add(37 * time.Second),
+		},
+		{
+			name:          "rounded",
+			start:         base.Add(7 * time.Second),
+			roundInterval: true,
+			period:        30 * time.Second,
+			since:         base,
+			until:         base.Add(30 * time.Second),
+		},
+		{
+			name:          "rounded on a boundary",
+			start:         base.Add(30 * time.Second),
+			roundInterval: true,
+			period:        30 * time.Second,
+			since:         base.Add(30 * time.Second),
+			until:         base.Add(60 * time.Second),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			since, until := updateWindow(tt.start, tt.roundInterval, tt.period)
+			if !since.Equal(tt.since) || !until.Equal(tt.until) {
+				t.Errorf("updateWindow() = [%s, %s), want [%s, %s)", since, until, tt.since, tt.until)
+			}
+		})
+	}
+}
+
+func TestCheckOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior string
+		err      error
+		wantErr  string
+	}{
+		{name: "connects"},
+		{name: "fails to connect", err: errors.New("connection refused"),
+			wantErr: "connecting output outputs.mock: connection refused"},
+		{name: "retried at startup", behavior: models.StartupErrorRetry,
+			err: errors.New("connection refused")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, p := newTestAgent()
+			output := &mockOutput{connectErr: tt.err}
+			addOutput(p, "mock", tt.behavior, output)
+
+			err := a.CheckOutputs()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("CheckOutputs() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Fatalf("CheckOutputs() error = %v, want %q", err, tt.wantErr)
+			}
+			if n := atomic.LoadInt32(&output.closed); n != 0 {
+				t.Errorf("output closed %d times by the check, want it kept for the run", n)
+			}
+		})
+	}
+}
+
+func TestCheckOutputsClosesOnFailure(t *testing.T) {
+	a, p := newTestAgent()
+	good := &mockOutput{}
+	addOutput(p, "good", "", good)
+	addOutput(p, "bad", "", &mockOutput{connectErr: errors.New("connection refused")})
+
+	if err := a.CheckOutputs(); err == nil {
+		t.Fatal("CheckOutputs() succeeded, want a connection error")
+	}
+	if n := atomic.LoadInt32(&good.closed); n != 1 {
+		t.Errorf("connected output closed %d times, want 1", n)
+	}
+}
+
+func TestStartOutputsKeepsCheckedConnection(t *testing.T) {
+	a, p := newTestAgent()
+	output := &mockOutput{}
+	addOutput(p, "mock", "", output)
+
+	if err := a.CheckOutputs(); err != nil {
+		t.Fatalf("CheckOutputs() error = %v", err)
+	}
+	_, unit, err := a.startOutputs(context.Background(), p, p.Outputs)
+	if err != nil {
+		t.Fatalf("startOutputs() error = %v", err)
+	}
+	defer a.stopOutputs(unit)
+
+	if n := atomic.LoadInt32(&output.connects); n != 1 {
+		t.Errorf("output connected %d times, want the checked connection used", n)
+	}
+	if n := atomic.LoadInt32(&output.closed); n != 0 {
+		t.Errorf("output closed %d times before the run, want 0", n)
+	}
+}
+
+func TestRunReturnsPipelineErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing []string // pipelines whose output fails to connect
+		wantErr string
+	}{
+		{name: "all running"},
+		{name: "one failing", failing: []string{"b"}, wantErr: "pipeline b: "},
+		{name: "first failing", failing: []string{"a"}, wantErr: "pipeline a: "},
+		{name: "all failing", failing: []string{"a", "b"}, wantErr: "2 errors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAgent()
+			a.Config.Pipelines = make(map[string]*config.Pipeline)
+			for _, name := range []string{"a", "b"} {
+				p := &config.Pipeline{Name: name}
+				output := &mockOutput{}
+				for _, failing := range tt.failing {
+					if failing == name {
+						output.connectErr = errors.New("connection refused")
+					}
+				}
+				addOutput(p, "mock", models.StartupErrorError, output)
+				a.Config.Pipelines[name] = p
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := a.Run(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Run() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
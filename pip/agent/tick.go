@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ezreal.com.cn/pip/internal"
+)
+
+// Ticker fires on Elapsed at the plugin interval.
+type Ticker interface {
+	Elapsed() <-chan time.Time
+	Stop()
+}
+
+// AlignedTicker delivers ticks at aligned times plus an optional jitter.  Each
+// tick is realigned to avoid drift and handle changes to the system clock.
+//
+// The ticks may have an jitter duration applied to them as an random offset to
+// the interval.  However the overall pace of is that of the interval, so on
+// average you will have one collection each interval.
+//
+// The first tick is emitted at the next alignment.
+//
+// Ticks are dropped for slow consumers.
+//
+// The implementation currently does not recalculate until the next tick with
+// no maximum sleep, when using large intervals alignment is not corrected
+// until the next tick.
+type AlignedTicker struct {
+	interval time.Duration
+	jitter   time.Duration
+	ch       chan time.Time
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewAlignedTicker returns a ticker aligned to multiples of interval.
+func NewAlignedTicker(now time.Time, interval, jitter time.Duration) *AlignedTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &AlignedTicker{
+		interval: interval,
+		jitter:   jitter,
+		ch:       make(chan time.Time, 1),
+		cancel:   cancel,
+	}
+
+	d := t.next(now)
+	timer := time.NewTimer(d)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(ctx, timer)
+	}()
+
+	return t
+}
+
+func (t *AlignedTicker) next(now time.Time) time.Duration {
+	next := internal.AlignTime(now, t.interval)
+	d := next.Sub(now)
+	if d == 0 {
+		d = t.interval
+	}
+	d += internal.RandomDuration(t.jitter)
+	return d
+}
+
+func (t *AlignedTicker) run(ctx context.Context, timer *time.Timer) {
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			select {
+			case t.ch <- now:
+			default:
+			}
+
+			d := t.next(now)
+			timer.Reset(d)
+		}
+	}
+}
+
+// Elapsed returns a channel which will fire when the interval elapses.
+func (t *AlignedTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+// Stop stops the ticker and waits for its goroutine to exit.
+func (t *AlignedTicker) Stop() {
+	t.cancel()
+	t.wg.Wait()
+}
+
+// UnalignedTicker delivers ticks at regular but unaligned intervals.  No
+// effort is made to avoid drift.
+//
+// The ticks may have an jitter duration applied to them as an random offset to
+// the interval.  However the overall pace of is that of the interval, so on
+// average you will have one collection each interval.
+//
+// The first tick is emitted immediately.
+//
+// Ticks are dropped for slow consumers.
+type UnalignedTicker struct {
+	interval time.Duration
+	jitter   time.Duration
+	ch       chan time.Time
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewUnalignedTicker returns a ticker that starts ticking immediately.
+func NewUnalignedTicker(interval, jitter time.Duration) *UnalignedTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &UnalignedTicker{
+		interval: interval,
+		jitter:   jitter,
+		ch:       make(chan time.Time, 1),
+		cancel:   cancel,
+	}
+
+	ticker := time.NewTicker(t.interval)
+	t.ch <- time.Now()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(ctx, ticker)
+	}()
+
+	return t
+}
+
+func (t *UnalignedTicker) run(ctx context.Context, ticker *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			jitter := internal.RandomDuration(t.jitter)
+			err := internal.SleepContext(ctx, jitter)
+			if err != nil {
+				ticker.Stop()
+				return
+			}
+			select {
+			case t.ch <- time.Now():
+			default:
+			}
+		}
+	}
+}
+
+// Elapsed returns a channel which will fire when the interval elapses.
+func (t *UnalignedTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+// Stop stops the ticker and waits for its goroutine to exit.
+func (t *UnalignedTicker) Stop() {
+	t.cancel()
+	t.wg.Wait()
+}
+
+// RollingTicker delivers ticks at regular but unaligned intervals.
+//
+// Because the next interval is scheduled based on the interval + jitter, you
+// are guaranteed at least interval seconds without missing a tick and ticks
+// will be evenly scheduled over time.
+//
+// On average you will have one collection each interval + (jitter/2).
+//
+// The first tick is emitted after interval+jitter seconds.
+//
+// Ticks are dropped for slow consumers.
+type RollingTicker struct {
+	interval time.Duration
+	jitter   time.Duration
+	ch       chan time.Time
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewRollingTicker returns a ticker that fires every interval plus a random
+// jitter.
+func NewRollingTicker(interval, jitter time.Duration) *RollingTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &RollingTicker{
+		interval: interval,
+		jitter:   jitter,
+		ch:       make(chan time.Time, 1),
+		cancel:   cancel,
+	}
+
+	d := t.next()
+	timer := time.NewTimer(d)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(ctx, timer)
+	}()
+
+	return t
+}
+
+func (t *RollingTicker) next() time.Duration {
+	return t.interval + internal.RandomDuration(t.jitter)
+}
+
+func (t *RollingTicker) run(ctx context.Context, timer *time.Timer) {
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			select {
+			case t.ch <- now:
+			default:
+			}
+
+			d := t.next()
+			timer.Reset(d)
+		}
+	}
+}
+
+// Elapsed returns a channel which will fire when the interval elapses.
+func (t *RollingTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+// Stop stops the ticker and waits for its goroutine to exit.
+func (t *RollingTicker) Stop() {
+	t.cancel()
+	t.wg.Wait()
+}
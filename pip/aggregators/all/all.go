@@ -0,0 +1,5 @@
+package all
+
+import (
+	_ "ezreal.com.cn/pip/pip/aggregators/minmax"
+)
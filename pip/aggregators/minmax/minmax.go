@@ -0,0 +1,128 @@
+package minmax
+
+import (
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/aggregators"
+)
+
+// MinMax keeps the minimum and maximum of each numeric field per series.
+type MinMax struct {
+	cache map[uint64]aggregate
+}
+
+// NewMinMax ...
+func NewMinMax() pip.Aggregator {
+	mm := &MinMax{}
+	mm.Reset()
+	return mm
+}
+
+type aggregate struct {
+	fields map[string]minmax
+	name   string
+	tags   map[string]string
+}
+
+type minmax struct {
+	min float64
+	max float64
+}
+
+var sampleConfig = `
+  ## General Aggregator Arguments:
+  ## The period on which to flush & clear the aggregator.
+  period = "30s"
+  ## If true, the original metric will be dropped by the
+  ## aggregator and will not get sent to the output plugins.
+  drop_original = false
+`
+
+// SampleConfig ...
+func (m *MinMax) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description ...
+func (m *MinMax) Description() string {
+	return "Keep the aggregate min/max of each metric passing through."
+}
+
+// Add ...
+func (m *MinMax) Add(in pip.Metric) {
+	id := in.HashID()
+	if _, ok := m.cache[id]; !ok {
+		// hit an uncached metric, create caches for first time:
+		a := aggregate{
+			name:   in.Name(),
+			tags:   in.Tags(),
+			fields: make(map[string]minmax),
+		}
+		for _, field := range in.FieldList() {
+			if fv, ok := convert(field.Value); ok {
+				a.fields[field.Key] = minmax{
+					min: fv,
+					max: fv,
+				}
+			}
+		}
+		m.cache[id] = a
+	} else {
+		for _, field := range in.FieldList() {
+			if fv, ok := convert(field.Value); ok {
+				if _, ok := m.cache[id].fields[field.Key]; !ok {
+					// hit an uncached field of a cached metric
+					m.cache[id].fields[field.Key] = minmax{
+						min: fv,
+						max: fv,
+					}
+					continue
+				}
+				if fv < m.cache[id].fields[field.Key].min {
+					tmp := m.cache[id].fields[field.Key]
+					tmp.min = fv
+					m.cache[id].fields[field.Key] = tmp
+				} else if fv > m.cache[id].fields[field.Key].max {
+					tmp := m.cache[id].fields[field.Key]
+					tmp.max = fv
+					m.cache[id].fields[field.Key] = tmp
+				}
+			}
+		}
+	}
+}
+
+// Push ...
+func (m *MinMax) Push(acc pip.Accumulator) {
+	for _, aggregate := range m.cache {
+		fields := map[string]interface{}{}
+		for k, v := range aggregate.fields {
+			fields[k+"_min"] = v.min
+			fields[k+"_max"] = v.max
+		}
+		acc.AddFields(aggregate.name, fields, aggregate.tags)
+	}
+}
+
+// Reset ...
+func (m *MinMax) Reset() {
+	m.cache = make(map[uint64]aggregate)
+}
+
+func convert(in interface{}) (float64, bool) {
+	switch v := in.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	aggregators.Add("minmax", func() pip.Aggregator {
+		return NewMinMax()
+	})
+}
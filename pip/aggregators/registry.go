@@ -0,0 +1,11 @@
+package aggregators
+
+import "ezreal.com.cn/pip/pip"
+
+type Creator func() pip.Aggregator
+
+var Aggregators = map[string]Creator{}
+
+func Add(name string, creator Creator) {
+	Aggregators[name] = creator
+}
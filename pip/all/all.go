@@ -1,7 +1,9 @@
 package all
 
 import (
+	_ "ezreal.com.cn/pip/pip/aggregators/all"
 	_ "ezreal.com.cn/pip/pip/input/all"
 	_ "ezreal.com.cn/pip/pip/output/all"
 	_ "ezreal.com.cn/pip/pip/processors/all"
+	_ "ezreal.com.cn/pip/pip/secretstores/all"
 )
@@ -1,5 +1,6 @@
 package all
 
 import (
+	_ "ezreal.com.cn/pip/pip/input/internal"
 	_ "ezreal.com.cn/pip/pip/input/simple"
 )
@@ -0,0 +1,213 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+// serializeVersion is the first byte of a serialized metric.
+const serializeVersion = 1
+
+// Field value kinds of a serialized metric.
+const (
+	kindFloat byte = iota + 1
+	kindInt
+	kindUint
+	kindString
+	kindBool
+)
+
+// ToBytes serializes the metric, without tracking information, into a
+// compact binary form that can be read back with FromBytes.
+func ToBytes(m pip.Metric) ([]byte, error) {
+	var buf bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(scratch[:], v)
+		buf.Write(scratch[:n])
+	}
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		buf.WriteString(s)
+	}
+
+	buf.WriteByte(serializeVersion)
+	putString(m.Name())
+	n := binary.PutVarint(scratch[:], m.Time().UnixNano())
+	buf.Write(scratch[:n])
+	buf.WriteByte(byte(m.Type()))
+	if m.IsAggregate() {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	putUvarint(uint64(len(m.TagList())))
+	for _, tag := range m.TagList() {
+		putString(tag.Key)
+		putString(tag.Value)
+	}
+
+	putUvarint(uint64(len(m.FieldList())))
+	for _, field := range m.FieldList() {
+		putString(field.Key)
+		switch v := field.Value.(type) {
+		case float64:
+			buf.WriteByte(kindFloat)
+			putUvarint(math.Float64bits(v))
+		case int64:
+			buf.WriteByte(kindInt)
+			n := binary.PutVarint(scratch[:], v)
+			buf.Write(scratch[:n])
+		case uint64:
+			buf.WriteByte(kindUint)
+			putUvarint(v)
+		case string:
+			buf.WriteByte(kindString)
+			putString(v)
+		case bool:
+			buf.WriteByte(kindBool)
+			if v {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+		default:
+			return nil, fmt.Errorf("field %q has unsupported type %T", field.Key, field.Value)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// FromBytes returns the metric serialized with ToBytes.
+func FromBytes(b []byte) (pip.Metric, error) {
+	r := bytes.NewReader(b)
+	m, err := readMetric(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errors.New("truncated metric")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding metric: %w", err)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("decoding metric: %d trailing bytes", r.Len())
+	}
+	return m, nil
+}
+
+func readMetric(r *bytes.Reader) (*metric, error) {
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if n > uint64(r.Len()) {
+			return "", io.ErrUnexpectedEOF
+		}
+		s := make([]byte, n)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	}
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != serializeVersion {
+		return nil, fmt.Errorf("unknown version %d", version)
+	}
+
+	m := &metric{}
+	if m.name, err = readString(); err != nil {
+		return nil, err
+	}
+	ns, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	m.tm = time.Unix(0, ns)
+	tp, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	m.tp = pip.ValueType(tp)
+	aggregate, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	m.aggregate = aggregate == 1
+
+	ntags, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < ntags; i++ {
+		tag := &pip.Tag{}
+		if tag.Key, err = readString(); err != nil {
+			return nil, err
+		}
+		if tag.Value, err = readString(); err != nil {
+			return nil, err
+		}
+		m.tags = append(m.tags, tag)
+	}
+
+	nfields, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < nfields; i++ {
+		field := &pip.Field{}
+		if field.Key, err = readString(); err != nil {
+			return nil, err
+		}
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case kindFloat:
+			bits, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = math.Float64frombits(bits)
+		case kindInt:
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = v
+		case kindUint:
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = v
+		case kindString:
+			v, err := readString()
+			if err != nil {
+				return nil, err
+			}
+			field.Value = v
+		case kindBool:
+			v, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			field.Value = v == 1
+		default:
+			return nil, fmt.Errorf("unknown kind %d of field %q", kind, field.Key)
+		}
+		m.fields = append(m.fields, field)
+	}
+	return m, nil
+}
@@ -0,0 +1,122 @@
+package metric
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	tm := time.Unix(1600000000, 123456789)
+	tests := []struct {
+		name   string
+		tags   map[string]string
+		fields map[string]interface{}
+		tp     pip.ValueType
+	}{
+		{name: "no tags", fields: map[string]interface{}{"value": 1.5}, tp: pip.Untyped},
+		{
+			name: "every field type",
+			tags: map[string]string{"host": "a", "region": "eu-1"},
+			fields: map[string]interface{}{
+				"float":  math.Inf(-1),
+				"int":    int64(-42),
+				"uint":   uint64(math.MaxUint64),
+				"string": "with\nnewline",
+				"bool":   true,
+			},
+			tp: pip.Gauge,
+		},
+		{name: "empty strings", tags: map[string]string{"empty": ""}, fields: map[string]interface{}{"s": ""}, tp: pip.Counter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New("cpu", tt.tags, tt.fields, tm, tt.tp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ToBytes(m)
+			if err != nil {
+				t.Fatalf("ToBytes() error = %v", err)
+			}
+			got, err := FromBytes(data)
+			if err != nil {
+				t.Fatalf("FromBytes() error = %v", err)
+			}
+
+			if got.Name() != m.Name() || !got.Time().Equal(m.Time()) || got.Type() != m.Type() {
+				t.Errorf("got %s %s %v, want %s %s %v",
+					got.Name(), got.Time(), got.Type(), m.Name(), m.Time(), m.Type())
+			}
+			if !reflect.DeepEqual(got.Tags(), m.Tags()) {
+				t.Errorf("got tags %v, want %v", got.Tags(), m.Tags())
+			}
+			if !reflect.DeepEqual(got.Fields(), m.Fields()) {
+				t.Errorf("got fields %v, want %v", got.Fields(), m.Fields())
+			}
+		})
+	}
+}
+
+func TestSerializeAggregate(t *testing.T) {
+	m, _ := New("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	m.SetAggregate(true)
+	data, err := ToBytes(m)
+	if err != nil {
+		t.Fatalf("ToBytes() error = %v", err)
+	}
+	got, err := FromBytes(data)
+	if err != nil {
+		t.Fatalf("FromBytes() error = %v", err)
+	}
+	if !got.IsAggregate() {
+		t.Error("aggregate flag lost")
+	}
+}
+
+func TestFromBytesErrors(t *testing.T) {
+	m, _ := New("cpu", map[string]string{"host": "a"}, map[string]interface{}{"value": "text"}, time.Unix(0, 0))
+	data, err := ToBytes(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "empty", data: nil, wantErr: "truncated metric"},
+		{name: "truncated", data: data[:len(data)-2], wantErr: "truncated metric"},
+		{name: "trailing bytes", data: append(append([]byte{}, data...), 0), wantErr: "1 trailing bytes"},
+		{name: "unknown version", data: append([]byte{9}, data[1:]...), wantErr: "unknown version 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromBytes(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("FromBytes() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestToBytesTracking(t *testing.T) {
+	m, _ := New("cpu", nil, map[string]interface{}{"value": int64(1)}, time.Unix(0, 0))
+	tracked, _ := WithTracking(m, func(pip.DeliveryInfo) {})
+	data, err := ToBytes(tracked)
+	if err != nil {
+		t.Fatalf("ToBytes() error = %v", err)
+	}
+	got, err := FromBytes(data)
+	if err != nil {
+		t.Fatalf("FromBytes() error = %v", err)
+	}
+	if IsTracked(got) {
+		t.Error("tracking information serialized")
+	}
+}
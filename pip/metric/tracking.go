@@ -0,0 +1,165 @@
+package metric
+
+import (
+	"sync/atomic"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+// NotifyFunc is called when a tracking metric is done being processed with
+// the tracking information.
+type NotifyFunc = func(track pip.DeliveryInfo)
+
+// WithTracking adds tracking to the metric and registers the notify function
+// to be called when processing is complete.
+func WithTracking(metric pip.Metric, fn NotifyFunc) (pip.Metric, pip.TrackingID) {
+	return newTrackingMetric(metric, fn)
+}
+
+// WithGroupTracking adds tracking to the metrics and registers the notify
+// function to be called when processing is complete.
+func WithGroupTracking(metric []pip.Metric, fn NotifyFunc) ([]pip.Metric, pip.TrackingID) {
+	return newTrackingMetricGroup(metric, fn)
+}
+
+// IsTracked reports whether the delivery of the metric is tracked.
+func IsTracked(m pip.Metric) bool {
+	_, ok := m.(*trackingMetric)
+	return ok
+}
+
+var lastID uint64
+
+func newTrackingID() pip.TrackingID {
+	return pip.TrackingID(atomic.AddUint64(&lastID, 1))
+}
+
+// trackingData is shared by every copy of a tracked metric, or by every
+// metric of a tracked group.  rc counts the metrics that have not yet been
+// accepted, rejected or dropped.
+type trackingData struct {
+	id          pip.TrackingID
+	rc          int32
+	acceptCount int32
+	rejectCount int32
+	notifyFunc  NotifyFunc
+}
+
+func (d *trackingData) incr() {
+	atomic.AddInt32(&d.rc, 1)
+}
+
+func (d *trackingData) decr() int32 {
+	return atomic.AddInt32(&d.rc, -1)
+}
+
+func (d *trackingData) accept() {
+	atomic.AddInt32(&d.acceptCount, 1)
+}
+
+func (d *trackingData) reject() {
+	atomic.AddInt32(&d.rejectCount, 1)
+}
+
+func (d *trackingData) notify() {
+	d.notifyFunc(
+		&deliveryInfo{
+			id:       d.id,
+			accepted: int(atomic.LoadInt32(&d.acceptCount)),
+			rejected: int(atomic.LoadInt32(&d.rejectCount)),
+		},
+	)
+}
+
+type trackingMetric struct {
+	pip.Metric
+	d *trackingData
+}
+
+func newTrackingMetric(metric pip.Metric, fn NotifyFunc) (pip.Metric, pip.TrackingID) {
+	m := &trackingMetric{
+		Metric: metric,
+		d: &trackingData{
+			id:          newTrackingID(),
+			rc:          1,
+			acceptCount: 0,
+			rejectCount: 0,
+			notifyFunc:  fn,
+		},
+	}
+	return m, m.d.id
+}
+
+func newTrackingMetricGroup(group []pip.Metric, fn NotifyFunc) ([]pip.Metric, pip.TrackingID) {
+	d := &trackingData{
+		id:          newTrackingID(),
+		rc:          0,
+		acceptCount: 0,
+		rejectCount: 0,
+		notifyFunc:  fn,
+	}
+
+	for i, m := range group {
+		d.incr()
+		dm := &trackingMetric{
+			Metric: m,
+			d:      d,
+		}
+		group[i] = dm
+	}
+
+	if len(group) == 0 {
+		d.notify()
+	}
+
+	return group, d.id
+}
+
+// Copy returns a deep copy of the metric that shares the tracking data, the
+// delivery is complete once the original and all copies are done.
+func (m *trackingMetric) Copy() pip.Metric {
+	m.d.incr()
+	return &trackingMetric{
+		Metric: m.Metric.Copy(),
+		d:      m.d,
+	}
+}
+
+func (m *trackingMetric) Accept() {
+	m.d.accept()
+	m.decr()
+}
+
+func (m *trackingMetric) Reject() {
+	m.d.reject()
+	m.decr()
+}
+
+func (m *trackingMetric) Drop() {
+	m.decr()
+}
+
+func (m *trackingMetric) decr() {
+	v := m.d.decr()
+	if v < 0 {
+		panic("negative refcount")
+	}
+
+	if v == 0 {
+		m.d.notify()
+	}
+}
+
+type deliveryInfo struct {
+	id       pip.TrackingID
+	accepted int
+	rejected int
+}
+
+func (r *deliveryInfo) ID() pip.TrackingID {
+	return r.id
+}
+
+func (r *deliveryInfo) Delivered() bool {
+	return r.rejected == 0
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"ezreal.com.cn/pip/metrics"
+	"ezreal.com.cn/pip/pip"
+)
+
+// Buffer strategies of an output.
+const (
+	// BufferStrategyMemory keeps the metrics of an output in memory.
+	BufferStrategyMemory = "memory"
+
+	// BufferStrategyDisk keeps the metrics of an output in a write-ahead log
+	// on disk, they survive outages of the output and restarts of the agent.
+	BufferStrategyDisk = "disk"
+)
+
+// Buffer stores the metrics of an output until they are written.
+type Buffer interface {
+	// Open prepares the buffer for use, loading any metrics it persisted.
+	Open() error
+
+	// Len returns the number of metrics currently in the buffer.
+	Len() int
+
+	// Add adds metrics to the buffer and returns number of dropped metrics.
+	Add(metrics ...pip.Metric) int
+
+	// Batch returns a slice containing up to batchSize of the oldest metrics
+	// in the buffer.  The batch must be passed back with Accept or Reject
+	// before the next call to Batch.
+	Batch(batchSize int) []pip.Metric
+
+	// Accept removes the metrics contained in the batch from the Buffer.
+	Accept(batch []pip.Metric)
+
+	// Reject returns the batch, acquired from Batch(), to the buffer and
+	// marks it as unsent.
+	Reject(batch []pip.Metric)
+
+	// Close releases the resources held by the buffer.
+	Close() error
+}
+
+// NewBuffer returns the buffer selected by the strategy of the output config,
+// capacity is the number of metrics kept by a memory buffer.
+func NewBuffer(config *OutputConfig, capacity int, log pip.Logger) Buffer {
+	if config.BufferStrategy == BufferStrategyDisk {
+		return NewDiskBuffer(config.Name, config.Alias, config.Pipeline,
+			config.BufferDirectory, config.BufferMaxSize, log)
+	}
+	return NewMemoryBuffer(config.Name, config.Alias, config.Pipeline, capacity)
+}
+
+// BufferStats are the statistics reported by a buffer.
+type BufferStats struct {
+	MetricsAdded   metrics.Stat
+	MetricsWritten metrics.Stat
+	MetricsDropped metrics.Stat
+	BufferSize     metrics.Stat
+	BufferLimit    metrics.Stat
+}
+
+// NewBufferStats registers the statistics of the buffer of an output,
+// pipeline is empty for the outputs of the default pipeline.
+func NewBufferStats(name string, alias string, pipeline string) BufferStats {
+	tags := bufferTags(name, alias, pipeline)
+
+	s := BufferStats{
+		MetricsAdded: metrics.Register(
+			"write",
+			"metrics_added",
+			tags,
+		),
+		MetricsWritten: metrics.Register(
+			"write",
+			"metrics_written",
+			tags,
+		),
+		MetricsDropped: metrics.Register(
+			"write",
+			"metrics_dropped",
+			tags,
+		),
+		BufferSize: metrics.Register(
+			"write",
+			"buffer_size",
+			tags,
+		),
+		BufferLimit: metrics.Register(
+			"write",
+			"buffer_limit",
+			tags,
+		),
+	}
+	s.BufferSize.Set(int64(0))
+	return s
+}
+
+// bufferTags returns the tags of the statistics of the buffer of an output.
+func bufferTags(name string, alias string, pipeline string) map[string]string {
+	tags := map[string]string{"output": name}
+	if alias != "" {
+		tags["alias"] = alias
+	}
+	if pipeline != "" {
+		tags["pipeline"] = pipeline
+	}
+	return tags
+}
+
+func (s *BufferStats) metricAdded() {
+	s.MetricsAdded.Incr(1)
+}
+
+func (s *BufferStats) metricWritten(metric pip.Metric) {
+	AgentMetricsWritten.Incr(1)
+	s.MetricsWritten.Incr(1)
+	metric.Accept()
+}
+
+func (s *BufferStats) metricDropped(metric pip.Metric) {
+	s.metricsDropped(1)
+	metric.Reject()
+}
+
+// metricsDropped counts metrics dropped without holding them.
+func (s *BufferStats) metricsDropped(n int) {
+	AgentMetricsDropped.Incr(int64(n))
+	s.MetricsDropped.Incr(int64(n))
+}
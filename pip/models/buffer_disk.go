@@ -0,0 +1,244 @@
+package models
+
+import (
+	"sync"
+
+	"ezreal.com.cn/pip/internal/wal"
+	"ezreal.com.cn/pip/metrics"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+const (
+	// diskBufferSegmentSize is the size of the segment files of a DiskBuffer.
+	diskBufferSegmentSize = 8 * 1024 * 1024
+
+	// diskBufferMinSegmentSize bounds the segment size derived from a small
+	// max size.
+	diskBufferMinSegmentSize = 64 * 1024
+)
+
+// DiskBuffer stores metrics in a write-ahead log on disk.  Metrics are
+// acknowledged once written to the log, kept across restarts and removed
+// from the log when a batch is accepted.
+type DiskBuffer struct {
+	sync.Mutex
+	BufferStats
+
+	// BufferMaxBytes is the max size of the log, the buffer has no limit
+	// on the number of metrics.
+	BufferMaxBytes metrics.Stat
+
+	path    string
+	maxSize int64
+	log     pip.Logger
+
+	wal       *wal.Log
+	batchSize int // number of metrics handed out by Batch
+}
+
+// NewDiskBuffer returns a DiskBuffer stored in the directory path, using at
+// most maxSize bytes of disk when maxSize is positive.  The buffer must be
+// opened before use.
+func NewDiskBuffer(
+	name string,
+	alias string,
+	pipeline string,
+	path string,
+	maxSize int64,
+	log pip.Logger,
+) *DiskBuffer {
+	b := &DiskBuffer{
+		BufferStats: NewBufferStats(name, alias, pipeline),
+		BufferMaxBytes: metrics.Register(
+			"write",
+			"buffer_max_bytes",
+			bufferTags(name, alias, pipeline),
+		),
+
+		path:    path,
+		maxSize: maxSize,
+		log:     log,
+	}
+	b.BufferMaxBytes.Set(maxSize)
+	return b
+}
+
+// Open opens the write-ahead log, metrics left by the previous run are
+// written again.
+func (b *DiskBuffer) Open() error {
+	b.Lock()
+	defer b.Unlock()
+
+	segmentSize := int64(diskBufferSegmentSize)
+	if b.maxSize > 0 && b.maxSize/4 < segmentSize {
+		// keep several segments so the oldest can be dropped
+		segmentSize = b.maxSize / 4
+		if segmentSize < diskBufferMinSegmentSize {
+			segmentSize = diskBufferMinSegmentSize
+		}
+	}
+
+	w, err := wal.Open(b.path, wal.Options{
+		SegmentSize: segmentSize,
+		MaxSize:     b.maxSize,
+	})
+	if err != nil {
+		return err
+	}
+	b.wal = w
+
+	if n := w.Repaired(); n > 0 {
+		b.log.Warnf("Removed %d bytes of damaged records from the disk buffer %s", n, b.path)
+	}
+	if n := w.Len(); n > 0 {
+		b.log.Infof("Loaded %d metrics from the disk buffer %s", n, b.path)
+	}
+	b.BufferSize.Set(int64(w.Len()))
+	return nil
+}
+
+// Len returns the number of metrics currently in the buffer.
+func (b *DiskBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.wal == nil {
+		return 0
+	}
+	return b.wal.Len()
+}
+
+// Add writes metrics to the log and returns number of dropped metrics, either
+// because they could not be written or because the log grew over its max
+// size.  The log is synced once for all the metrics before they are
+// accepted.
+func (b *DiskBuffer) Add(metrics ...pip.Metric) int {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.wal == nil {
+		for _, m := range metrics {
+			b.metricDropped(m)
+		}
+		return len(metrics)
+	}
+
+	first := b.wal.First()
+	dropped := 0
+	written := make([]pip.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		data, err := metric.ToBytes(m)
+		if err == nil {
+			_, err = b.wal.Append(data)
+		}
+		if err != nil {
+			b.log.Errorf("Error writing metric to the disk buffer: %v", err)
+			b.metricDropped(m)
+			dropped++
+			continue
+		}
+
+		b.metricAdded()
+		written = append(written, m)
+	}
+
+	if err := b.wal.Sync(); err != nil {
+		// the metrics stay in the log but may not survive a crash
+		b.log.Errorf("Error syncing the disk buffer: %v", err)
+		for _, m := range written {
+			m.Reject()
+		}
+	} else {
+		// the metrics are persisted, they will be delivered from the log
+		for _, m := range written {
+			m.Accept()
+		}
+	}
+
+	if n := int(b.wal.First() - first); n > 0 {
+		b.metricsDropped(n)
+		dropped += n
+		b.batchSize -= min(n, b.batchSize)
+	}
+
+	b.BufferSize.Set(int64(b.wal.Len()))
+	return dropped
+}
+
+// Batch returns a slice containing up to batchSize of the oldest metrics in
+// the log, metrics that cannot be read are dropped.
+func (b *DiskBuffer) Batch(batchSize int) []pip.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.wal == nil {
+		return nil
+	}
+
+	b.batchSize = min(b.wal.Len(), batchSize)
+	out := make([]pip.Metric, 0, b.batchSize)
+
+	first := b.wal.First()
+	for i := 0; i < b.batchSize; i++ {
+		data, err := b.wal.Read(first + uint64(i))
+		var m pip.Metric
+		if err == nil {
+			m, err = metric.FromBytes(data)
+		}
+		if err != nil {
+			b.log.Errorf("Error reading metric from the disk buffer: %v", err)
+			b.metricsDropped(1)
+			continue
+		}
+		out = append(out, m)
+	}
+
+	if len(out) == 0 && b.batchSize > 0 {
+		// nothing readable, skip the records so they do not block the log
+		b.wal.TruncateFront(first + uint64(b.batchSize))
+		b.batchSize = 0
+		b.BufferSize.Set(int64(b.wal.Len()))
+	}
+	return out
+}
+
+// Accept removes the metrics contained in the batch from the log.
+func (b *DiskBuffer) Accept(batch []pip.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, m := range batch {
+		b.metricWritten(m)
+	}
+	if b.wal == nil {
+		return
+	}
+
+	if err := b.wal.TruncateFront(b.wal.First() + uint64(b.batchSize)); err != nil {
+		b.log.Errorf("Error removing written metrics from the disk buffer: %v", err)
+	}
+	b.batchSize = 0
+	b.BufferSize.Set(int64(b.wal.Len()))
+}
+
+// Reject leaves the metrics of the batch in the log to be written again.
+func (b *DiskBuffer) Reject(batch []pip.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.batchSize = 0
+}
+
+// Close closes the log, the metrics still in it are kept for the next run.
+func (b *DiskBuffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.wal == nil {
+		return nil
+	}
+	err := b.wal.Close()
+	b.wal = nil
+	return err
+}
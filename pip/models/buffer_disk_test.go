@@ -0,0 +1,106 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+func openDiskBuffer(t *testing.T, name string, dir string, maxSize int64) *DiskBuffer {
+	t.Helper()
+	b := NewDiskBuffer(name, "", "", dir, maxSize, NewLogger("", "outputs", name, ""))
+	if err := b.Open(); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return b
+}
+
+func TestDiskBufferKeepsUnwrittenMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept bool
+		want   []int64
+	}{
+		{name: "accepted batch", accept: true, want: []int64{3, 4}},
+		{name: "rejected batch", accept: false, want: []int64{0, 1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "buffer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			b := openDiskBuffer(t, "disk", dir, 0)
+			for i := 0; i < 5; i++ {
+				b.Add(testMetric(t, int64(i)))
+			}
+			batch := b.Batch(3)
+			if got := metricValues(batch); !reflect.DeepEqual(got, []int64{0, 1, 2}) {
+				t.Fatalf("Batch() = %v, want [0 1 2]", got)
+			}
+			if tt.accept {
+				b.Accept(batch)
+			} else {
+				b.Reject(batch)
+			}
+			if err := b.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			b = openDiskBuffer(t, "disk", dir, 0)
+			defer b.Close()
+			if got := metricValues(b.Batch(10)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Batch() after reopening = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskBufferAcceptsOnceSynced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := openDiskBuffer(t, "disk-sync", dir, 0)
+	defer b.Close()
+
+	var delivered []bool
+	var metrics []pip.Metric
+	for i := 0; i < 3; i++ {
+		m, _ := metric.WithTracking(testMetric(t, int64(i)), func(info pip.DeliveryInfo) {
+			delivered = append(delivered, info.Delivered())
+		})
+		metrics = append(metrics, m)
+	}
+	if dropped := b.Add(metrics...); dropped != 0 {
+		t.Errorf("Add() dropped %d metrics", dropped)
+	}
+	if !reflect.DeepEqual(delivered, []bool{true, true, true}) {
+		t.Errorf("deliveries %v, want every metric accepted once written", delivered)
+	}
+}
+
+func TestDiskBufferStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := openDiskBuffer(t, "disk-stats", dir, 1<<20)
+	defer b.Close()
+	if n := b.BufferMaxBytes.Get(); n != 1<<20 {
+		t.Errorf("BufferMaxBytes = %d, want %d", n, 1<<20)
+	}
+	if n := b.BufferLimit.Get(); n != 0 {
+		t.Errorf("BufferLimit = %d, want 0 as the disk buffer has no metric limit", n)
+	}
+}
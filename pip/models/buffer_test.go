@@ -0,0 +1,32 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBufferStatsTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		alias    string
+		pipeline string
+		want     map[string]string
+	}{
+		{name: "plain", want: map[string]string{"output": "tagged"}},
+		{name: "alias", alias: "a", want: map[string]string{"output": "tagged", "alias": "a"}},
+		{name: "pipeline", pipeline: "web", want: map[string]string{"output": "tagged", "pipeline": "web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBuffer("tagged", tt.alias, tt.pipeline, 10)
+			for _, tags := range []map[string]string{
+				b.MetricsAdded.Tags(), b.MetricsWritten.Tags(), b.MetricsDropped.Tags(),
+				b.BufferSize.Tags(), b.BufferLimit.Tags(),
+			} {
+				if !reflect.DeepEqual(tags, tt.want) {
+					t.Errorf("got tags %v, want %v", tags, tt.want)
+				}
+			}
+		})
+	}
+}
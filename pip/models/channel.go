@@ -0,0 +1,338 @@
+package models
+
+import (
+	"ezreal.com.cn/pip/internal/wal"
+	"ezreal.com.cn/pip/metrics"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+// Overflow policies of a pipeline channel, applied when a metric is sent to
+// a full channel.
+const (
+	// OverflowBlock blocks the sender until there is room in the channel.
+	OverflowBlock = "block"
+
+	// OverflowDropNewest drops the metric being sent.
+	OverflowDropNewest = "drop-newest"
+
+	// OverflowDropOldest drops the oldest metric in the channel to make room.
+	OverflowDropOldest = "drop-oldest"
+
+	// OverflowSpill writes the metric to a write-ahead log on disk, it is
+	// passed on once the channel has room again.
+	OverflowSpill = "spill-to-disk"
+)
+
+// ChannelConfig holds the settings of a pipeline channel.
+type ChannelConfig struct {
+	Name           string
+	Capacity       int
+	OverflowPolicy string
+
+	// SpillDirectory and SpillMaxSize configure the log of the
+	// "spill-to-disk" policy, a SpillMaxSize of zero means no limit.
+	SpillDirectory string
+	SpillMaxSize   int64
+}
+
+// Channel connects two stages of the pipeline.  With the "block" policy it is
+// a plain buffered channel, the other policies run a goroutine that always
+// accepts metrics from the sender and queues up to Capacity of them for the
+// receiver, applying the policy to metrics that do not fit.
+//
+// Closing the sending side closes the receiving side once all queued metrics
+// have been received.
+type Channel struct {
+	Config *ChannelConfig
+
+	MetricsDropped metrics.Stat
+	MetricsSpilled metrics.Stat
+
+	in    chan pip.Metric
+	out   chan pip.Metric
+	stop  chan struct{}
+	done  chan struct{}
+	queue []pip.Metric
+	full  bool // the overflow policy is being applied
+	log   pip.Logger
+
+	spill *wal.Log
+	// next is the index of the next record to read from the spill log.
+	next uint64
+	// logged holds the log index of the metrics at the end of the queue
+	// that were read from the spill log, their records are only removed
+	// once the metrics are received.
+	logged []uint64
+	// tracked holds the spilled metrics whose delivery is tracked by log
+	// index, they are passed on instead of the copy read back from the log
+	// so the sender is notified of their delivery.  The number of tracked
+	// metrics is bounded by the inputs.
+	tracked map[uint64]pip.Metric
+}
+
+// NewChannel returns a new Channel, it must be started before use.
+func NewChannel(config *ChannelConfig) *Channel {
+	tags := map[string]string{"channel": config.Name}
+
+	c := &Channel{
+		Config: config,
+		MetricsDropped: metrics.Register(
+			"channel",
+			"metrics_dropped",
+			tags,
+		),
+		MetricsSpilled: metrics.Register(
+			"channel",
+			"metrics_spilled",
+			tags,
+		),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		tracked: make(map[uint64]pip.Metric),
+		log:     NewLogger("", "channels", config.Name, ""),
+	}
+
+	if config.OverflowPolicy == OverflowBlock || config.OverflowPolicy == "" {
+		ch := make(chan pip.Metric, config.Capacity)
+		c.in, c.out = ch, ch
+	} else {
+		c.in = make(chan pip.Metric)
+		c.out = make(chan pip.Metric)
+	}
+	return c
+}
+
+// In returns the sending side of the channel.
+func (c *Channel) In() chan<- pip.Metric {
+	return c.in
+}
+
+// Out returns the receiving side of the channel.
+func (c *Channel) Out() <-chan pip.Metric {
+	return c.out
+}
+
+// Start opens the spill log, metrics it kept from the previous run are
+// received first, and starts queueing metrics.
+func (c *Channel) Start() error {
+	if c.in == c.out {
+		return nil
+	}
+
+	if c.Config.OverflowPolicy == OverflowSpill {
+		w, err := wal.Open(c.Config.SpillDirectory, wal.Options{
+			MaxSize: c.Config.SpillMaxSize,
+		})
+		if err != nil {
+			return err
+		}
+		c.spill = w
+		c.next = w.First()
+
+		if n := w.Repaired(); n > 0 {
+			c.log.Warnf("Removed %d bytes of damaged records from the spill log %s",
+				n, c.Config.SpillDirectory)
+		}
+		if n := w.Len(); n > 0 {
+			c.log.Infof("Loaded %d metrics from the spill log %s", n, c.Config.SpillDirectory)
+		}
+		c.refill()
+	}
+
+	go c.run()
+	return nil
+}
+
+// Stop discards a started channel that will not be used, nothing may be sent
+// to it afterward.  Queued metrics are rejected, the ones read from the spill
+// log are kept in it for the next run.
+func (c *Channel) Stop() {
+	if c.in == c.out {
+		return
+	}
+	close(c.stop)
+	<-c.done
+}
+
+func (c *Channel) run() {
+	defer close(c.done)
+	defer close(c.out)
+	if c.spill != nil {
+		defer c.closeSpill()
+	}
+
+	in := c.in
+	for in != nil || len(c.queue) > 0 {
+		if len(c.queue) == 0 {
+			c.full = false
+			select {
+			case m, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				c.push(m)
+			case <-c.stop:
+				c.discard()
+				return
+			}
+			continue
+		}
+
+		select {
+		case m, ok := <-in:
+			if !ok {
+				// a nil channel is never ready, keep draining the queue
+				in = nil
+				continue
+			}
+			c.push(m)
+		case c.out <- c.queue[0]:
+			if len(c.queue) == len(c.logged) {
+				c.logged = c.logged[1:]
+			}
+			c.queue[0] = nil
+			c.queue = c.queue[1:]
+			if len(c.queue) <= c.Config.Capacity/2 {
+				c.refill()
+			}
+		case <-c.stop:
+			c.discard()
+			return
+		}
+	}
+}
+
+// push queues the metric, applying the overflow policy when the queue is
+// full.
+func (c *Channel) push(m pip.Metric) {
+	spilling := c.spill != nil && c.next < c.spill.Last()
+	if len(c.queue) < c.Config.Capacity && !spilling {
+		c.queue = append(c.queue, m)
+		return
+	}
+
+	if !c.full {
+		c.full = true
+		c.log.Warnf("Channel is full, applying the %q overflow policy", c.Config.OverflowPolicy)
+	}
+
+	switch c.Config.OverflowPolicy {
+	case OverflowDropNewest:
+		c.dropped(m)
+	case OverflowDropOldest:
+		if len(c.queue) == 0 {
+			c.dropped(m)
+			return
+		}
+		c.dropped(c.queue[0])
+		c.queue[0] = nil
+		c.queue = append(c.queue[1:], m)
+	case OverflowSpill:
+		data, err := metric.ToBytes(m)
+		var index uint64
+		if err == nil {
+			index, err = c.spill.Append(data)
+		}
+		if err != nil {
+			c.log.Errorf("Error writing metric to the spill log: %v", err)
+			c.dropped(m)
+			return
+		}
+		c.MetricsSpilled.Incr(1)
+		if metric.IsTracked(m) {
+			c.tracked[index] = m
+		}
+		c.spillTrimmed()
+	}
+}
+
+// spillTrimmed drops the metrics removed from the spill log before they were
+// read, when the log grew over its max size.
+func (c *Channel) spillTrimmed() {
+	first := c.spill.First()
+	if c.next >= first {
+		return
+	}
+
+	n := int64(first - c.next)
+	for index := c.next; index < first; index++ {
+		if m, ok := c.tracked[index]; ok {
+			delete(c.tracked, index)
+			m.Reject()
+		}
+	}
+	c.next = first
+	AgentMetricsDropped.Incr(n)
+	c.MetricsDropped.Incr(n)
+}
+
+// refill removes the received metrics from the spill log and moves metrics
+// from the log to the queue while it has room, the queue is only empty once
+// the log is.
+func (c *Channel) refill() {
+	if c.spill == nil {
+		return
+	}
+	c.truncateSpill()
+
+	index := c.next
+	for ; len(c.queue) < c.Config.Capacity && index < c.spill.Last(); index++ {
+		m, ok := c.tracked[index]
+		if ok {
+			delete(c.tracked, index)
+		} else {
+			data, err := c.spill.Read(index)
+			if err == nil {
+				m, err = metric.FromBytes(data)
+			}
+			if err != nil {
+				c.log.Errorf("Error reading metric from the spill log: %v", err)
+				AgentMetricsDropped.Incr(1)
+				c.MetricsDropped.Incr(1)
+				continue
+			}
+		}
+		c.queue = append(c.queue, m)
+		c.logged = append(c.logged, index)
+	}
+	c.next = index
+}
+
+// truncateSpill removes the records of the spill log before the first one
+// still queued.
+func (c *Channel) truncateSpill() {
+	index := c.next
+	if len(c.logged) > 0 {
+		index = c.logged[0]
+	}
+	if err := c.spill.TruncateFront(index); err != nil {
+		c.log.Errorf("Error removing metrics from the spill log: %v", err)
+	}
+}
+
+// discard rejects the queued metrics when the channel is stopped.
+func (c *Channel) discard() {
+	for _, m := range c.queue {
+		m.Reject()
+	}
+	c.queue = nil
+	for index, m := range c.tracked {
+		delete(c.tracked, index)
+		m.Reject()
+	}
+}
+
+func (c *Channel) closeSpill() {
+	c.truncateSpill()
+	if err := c.spill.Close(); err != nil {
+		c.log.Errorf("Error closing the spill log: %v", err)
+	}
+}
+
+func (c *Channel) dropped(m pip.Metric) {
+	AgentMetricsDropped.Incr(1)
+	c.MetricsDropped.Incr(1)
+	m.Reject()
+}
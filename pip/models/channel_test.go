@@ -0,0 +1,230 @@
+package models
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+func testMetric(t *testing.T, value int64) pip.Metric {
+	t.Helper()
+	m, err := metric.New("test", nil, map[string]interface{}{"value": value}, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func metricValues(metrics []pip.Metric) []int64 {
+	var values []int64
+	for _, m := range metrics {
+		v, _ := m.GetField("value")
+		values = append(values, v.(int64))
+	}
+	return values
+}
+
+// receiveAll closes the sending side of the channel and returns the metrics
+// left in it.
+func receiveAll(ch *Channel) []pip.Metric {
+	close(ch.In())
+	var out []pip.Metric
+	for m := range ch.Out() {
+		out = append(out, m)
+	}
+	return out
+}
+
+func startChannel(t *testing.T, config *ChannelConfig) *Channel {
+	t.Helper()
+	ch := NewChannel(config)
+	if err := ch.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	return ch
+}
+
+func TestChannelOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		want    []int64
+		dropped int64
+	}{
+		{name: "block", policy: OverflowBlock, want: []int64{0, 1, 2, 3}},
+		{name: "drop newest", policy: OverflowDropNewest, want: []int64{0, 1, 2, 3}, dropped: 6},
+		{name: "drop oldest", policy: OverflowDropOldest, want: []int64{6, 7, 8, 9}, dropped: 6},
+		{name: "spill to disk", policy: OverflowSpill, want: []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "channel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			spillDir := filepath.Join(dir, "spill")
+			ch := startChannel(t, &ChannelConfig{
+				Name:           "test-" + tt.policy,
+				Capacity:       4,
+				OverflowPolicy: tt.policy,
+				SpillDirectory: spillDir,
+			})
+			// stats are registered once per channel name
+			dropped := ch.MetricsDropped.Get()
+
+			sent := 10
+			if tt.policy == OverflowBlock {
+				// a blocking channel only takes what fits
+				sent = 4
+			}
+			for i := 0; i < sent; i++ {
+				ch.In() <- testMetric(t, int64(i))
+			}
+
+			got := metricValues(receiveAll(ch))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("received %v, want %v", got, tt.want)
+			}
+			if n := ch.MetricsDropped.Get() - dropped; n != tt.dropped {
+				t.Errorf("MetricsDropped = %d, want %d", n, tt.dropped)
+			}
+			if _, err := os.Stat(spillDir); err == nil {
+				if files, _ := ioutil.ReadDir(spillDir); len(files) != 0 {
+					t.Errorf("spill log not removed once empty: %d files left", len(files))
+				}
+			}
+		})
+	}
+}
+
+func TestChannelTracking(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		accept    bool
+		delivered bool
+	}{
+		{name: "dropped metric is not delivered", policy: OverflowDropNewest, delivered: false},
+		{name: "spilled metric accepted by receiver", policy: OverflowSpill, accept: true, delivered: true},
+		{name: "spilled metric rejected by receiver", policy: OverflowSpill, accept: false, delivered: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "channel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			ch := startChannel(t, &ChannelConfig{
+				Name:           "tracking-" + tt.policy,
+				Capacity:       1,
+				OverflowPolicy: tt.policy,
+				SpillDirectory: dir,
+			})
+
+			delivered := make(chan bool, 1)
+			notify := func(info pip.DeliveryInfo) {
+				delivered <- info.Delivered()
+			}
+
+			ch.In() <- testMetric(t, 0)
+			tracked, _ := metric.WithTracking(testMetric(t, 1), notify)
+			ch.In() <- tracked
+
+			for _, m := range receiveAll(ch) {
+				if tt.accept {
+					m.Accept()
+				} else {
+					m.Reject()
+				}
+			}
+
+			select {
+			case got := <-delivered:
+				if got != tt.delivered {
+					t.Errorf("Delivered() = %v, want %v", got, tt.delivered)
+				}
+			default:
+				t.Fatal("no delivery notification")
+			}
+		})
+	}
+}
+
+func TestChannelSpillNotifiesOnReceive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ch := startChannel(t, &ChannelConfig{
+		Name:           "spill-notify",
+		Capacity:       1,
+		OverflowPolicy: OverflowSpill,
+		SpillDirectory: dir,
+	})
+
+	delivered := make(chan bool, 1)
+	ch.In() <- testMetric(t, 0)
+	tracked, _ := metric.WithTracking(testMetric(t, 1), func(info pip.DeliveryInfo) {
+		delivered <- info.Delivered()
+	})
+	ch.In() <- tracked
+
+	select {
+	case <-delivered:
+		t.Fatal("spilled metric reported before it was received")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, m := range receiveAll(ch) {
+		m.Accept()
+	}
+	if !<-delivered {
+		t.Error("spilled metric not delivered")
+	}
+}
+
+func TestChannelStopKeepsSpilledMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &ChannelConfig{
+		Name:           "spill-stop",
+		Capacity:       2,
+		OverflowPolicy: OverflowSpill,
+		SpillDirectory: dir,
+	}
+
+	ch := startChannel(t, config)
+	for i := 0; i < 6; i++ {
+		ch.In() <- testMetric(t, int64(i))
+	}
+	// receive one spilled metric, its record must not come back
+	for i := 0; i < 3; i++ {
+		<-ch.Out()
+	}
+	ch.Stop()
+
+	ch = startChannel(t, config)
+	got := metricValues(receiveAll(ch))
+	// 3 and 4 were queued from the spill log when the channel stopped, they
+	// are read again
+	want := []int64{3, 4, 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("received %v after restart, want %v", got, want)
+	}
+}
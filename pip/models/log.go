@@ -0,0 +1,126 @@
+package models
+
+import (
+	"log"
+	"reflect"
+	"sync/atomic"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+// Logger defines a logging structure for plugins.
+type Logger struct {
+	// Must be 64-bit aligned
+	errs int64
+
+	OnErrs []func()
+	Name   string // Name is the plugin name, will be printed in the `[]`.
+}
+
+// NewLogger creates a new logger instance, pipeline is empty for the plugins
+// of the default pipeline.
+func NewLogger(pipeline, pluginType, name, alias string) *Logger {
+	return &Logger{
+		Name: logName(pipeline, pluginType, name, alias),
+	}
+}
+
+// OnErr defines a callback that triggers only when errors are about to be written to the log
+func (l *Logger) OnErr(f func()) {
+	l.OnErrs = append(l.OnErrs, f)
+}
+
+// Errors returns the number of errors logged by the plugin.
+func (l *Logger) Errors() int64 {
+	return atomic.LoadInt64(&l.errs)
+}
+
+func (l *Logger) onErr() {
+	atomic.AddInt64(&l.errs, 1)
+	for _, f := range l.OnErrs {
+		f()
+	}
+}
+
+// Errorf logs an error message, patterned after log.Printf.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.onErr()
+	log.Printf("E! ["+l.Name+"] "+format, args...)
+}
+
+// Error logs an error message, patterned after log.Print.
+func (l *Logger) Error(args ...interface{}) {
+	l.onErr()
+	log.Print(append([]interface{}{"E! [" + l.Name + "] "}, args...)...)
+}
+
+// Debugf logs a debug message, patterned after log.Printf.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	log.Printf("D! ["+l.Name+"] "+format, args...)
+}
+
+// Debug logs a debug message, patterned after log.Print.
+func (l *Logger) Debug(args ...interface{}) {
+	log.Print(append([]interface{}{"D! [" + l.Name + "] "}, args...)...)
+}
+
+// Warnf logs a warning message, patterned after log.Printf.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	log.Printf("W! ["+l.Name+"] "+format, args...)
+}
+
+// Warn logs a warning message, patterned after log.Print.
+func (l *Logger) Warn(args ...interface{}) {
+	log.Print(append([]interface{}{"W! [" + l.Name + "] "}, args...)...)
+}
+
+// Infof logs an information message, patterned after log.Printf.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	log.Printf("I! ["+l.Name+"] "+format, args...)
+}
+
+// Info logs an information message, patterned after log.Print.
+func (l *Logger) Info(args ...interface{}) {
+	log.Print(append([]interface{}{"I! [" + l.Name + "] "}, args...)...)
+}
+
+// logName returns the log-friendly name/type, prefixed with the name of the
+// pipeline when it is not the default one.
+func logName(pipeline, pluginType, name, alias string) string {
+	if pipeline != "" {
+		pluginType = pipeline + "." + pluginType
+	}
+	if alias == "" {
+		return pluginType + "." + name
+	}
+	return pluginType + "." + name + "::" + alias
+}
+
+// SetLoggerOnPlugin sets log on the exported "Log" field of the plugin, if
+// it has one of type pip.Logger.
+func SetLoggerOnPlugin(i interface{}, log pip.Logger) {
+	valI := reflect.ValueOf(i)
+
+	if valI.Type().Kind() != reflect.Ptr {
+		valI = reflect.New(reflect.TypeOf(i))
+	}
+
+	if valI.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	field := valI.Elem().FieldByName("Log")
+	if !field.IsValid() {
+		return
+	}
+
+	switch field.Type().String() {
+	case "pip.Logger":
+		if field.CanSet() {
+			field.Set(reflect.ValueOf(log))
+		}
+	default:
+		log.Debugf("Plugin %q defines a 'Log' field on its struct of an unexpected type %q. Expected pip.Logger",
+			valI.Type().Name(), field.Type().String())
+	}
+}
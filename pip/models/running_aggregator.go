@@ -0,0 +1,171 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"ezreal.com.cn/pip/metrics"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+// RunningAggregator ...
+type RunningAggregator struct {
+	sync.Mutex
+	Aggregator  pip.Aggregator
+	Config      *AggregatorConfig
+	periodStart time.Time
+	periodEnd   time.Time
+	log         pip.Logger
+
+	MetricsPushed   metrics.Stat
+	MetricsFiltered metrics.Stat
+	MetricsDropped  metrics.Stat
+	PushTime        metrics.Stat
+}
+
+// NewRunningAggregator ...
+func NewRunningAggregator(aggregator pip.Aggregator, config *AggregatorConfig) *RunningAggregator {
+	tags := map[string]string{"aggregator": config.Name}
+	if config.Alias != "" {
+		tags["alias"] = config.Alias
+	}
+	if config.Pipeline != "" {
+		tags["pipeline"] = config.Pipeline
+	}
+
+	logger := NewLogger(config.Pipeline, "aggregators", config.Name, config.Alias)
+	SetLoggerOnPlugin(aggregator, logger)
+
+	return &RunningAggregator{
+		Aggregator: aggregator,
+		Config:     config,
+		log:        logger,
+		MetricsPushed: metrics.Register(
+			"aggregate",
+			"metrics_pushed",
+			tags,
+		),
+		MetricsFiltered: metrics.Register(
+			"aggregate",
+			"metrics_filtered",
+			tags,
+		),
+		MetricsDropped: metrics.Register(
+			"aggregate",
+			"metrics_dropped",
+			tags,
+		),
+		PushTime: metrics.RegisterTiming(
+			"aggregate",
+			"push_time_ns",
+			tags,
+		),
+	}
+}
+
+// AggregatorConfig is the common config for all aggregators.
+type AggregatorConfig struct {
+	Name  string
+	Alias string
+	// Pipeline is the name of the pipeline of the plugin, empty for the
+	// default pipeline.
+	Pipeline     string
+	DropOriginal bool
+	Period       time.Duration
+	Delay        time.Duration
+	Grace        time.Duration
+	Filter       Filter
+}
+
+// LogName ...
+func (r *RunningAggregator) LogName() string {
+	return logName(r.Config.Pipeline, "aggregators", r.Config.Name, r.Config.Alias)
+}
+
+// Init ...
+func (r *RunningAggregator) Init() error {
+	if p, ok := r.Aggregator.(pip.Initializer); ok {
+		return p.Init()
+	}
+	return nil
+}
+
+// Log ...
+func (r *RunningAggregator) Log() pip.Logger {
+	return r.log
+}
+
+// Period returns the length of an aggregation window.
+func (r *RunningAggregator) Period() time.Duration {
+	return r.Config.Period
+}
+
+// EndPeriod returns the end of the current aggregation window.
+func (r *RunningAggregator) EndPeriod() time.Time {
+	return r.periodEnd
+}
+
+// UpdateWindow sets the current aggregation window to [start, until).
+func (r *RunningAggregator) UpdateWindow(start, until time.Time) {
+	r.periodStart = start
+	r.periodEnd = until
+	r.log.Debugf("Updated aggregation range [%s, %s]", start, until)
+}
+
+// MakeMetric marks metrics pushed by the aggregator as aggregates.
+func (r *RunningAggregator) MakeMetric(metric pip.Metric) pip.Metric {
+	metric.SetAggregate(true)
+	r.MetricsPushed.Incr(1)
+	return metric
+}
+
+// Add a metric to the aggregator and return true if the original metric
+// should be dropped.
+func (r *RunningAggregator) Add(m pip.Metric) bool {
+	if ok := r.Config.Filter.Select(m); !ok {
+		return false
+	}
+
+	// Make a copy of the metric but don't retain tracking.  We do not fail a
+	// delivery due to the aggregation not being sent because we can't create
+	// aggregations of historical data.  Additionally, waiting for the
+	// aggregation to be pushed would introduce a hefty latency to delivery.
+	m = metric.FromMetric(m)
+
+	r.Config.Filter.Modify(m)
+	if len(m.FieldList()) == 0 {
+		r.MetricsFiltered.Incr(1)
+		return r.Config.DropOriginal
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if m.Time().Before(r.periodStart.Add(-r.Config.Grace)) || m.Time().After(r.periodEnd.Add(r.Config.Delay)) {
+		r.log.Debugf("Metric is outside aggregation window; discarding. %s: m: %s e: %s g: %s",
+			m.Time(), r.periodStart, r.periodEnd, r.Config.Grace)
+		r.MetricsDropped.Incr(1)
+		return r.Config.DropOriginal
+	}
+
+	r.Aggregator.Add(m)
+	return r.Config.DropOriginal
+}
+
+// Push pushes the aggregates of the current window to acc, then resets the
+// aggregator and advances the window by one period.
+func (r *RunningAggregator) Push(acc pip.Accumulator) {
+	r.Lock()
+	defer r.Unlock()
+
+	since := r.periodEnd
+	until := r.periodEnd.Add(r.Config.Period)
+	r.UpdateWindow(since, until)
+
+	start := time.Now()
+	r.Aggregator.Push(acc)
+	elapsed := time.Since(start)
+	r.PushTime.Incr(elapsed.Nanoseconds())
+	r.Aggregator.Reset()
+}
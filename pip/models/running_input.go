@@ -1,6 +1,11 @@
 package models
 
-import "ezreal.com.cn/pip/pip"
+import (
+	"time"
+
+	"ezreal.com.cn/pip/metrics"
+	"ezreal.com.cn/pip/pip"
+)
 
 // RunningInput ...
 type RunningInput struct {
@@ -8,22 +13,60 @@ type RunningInput struct {
 
 	Config *InputConfig
 
+	log         pip.Logger
 	defaultTags map[string]string
+
+	MetricsGathered metrics.Stat
+	MetricsFiltered metrics.Stat
+	GatherTime      metrics.Stat
+	GatherErrors    metrics.Stat
 }
 
 // LogName ...
 func (r *RunningInput) LogName() string {
-	return ""
+	return logName(r.Config.Pipeline, "inputs", r.Config.Name, r.Config.Alias)
 }
 
-// MakeMetric ...
+// MakeMetric applies the input settings to the metric, it returns nil if the
+// metric was filtered out.
+//
+// The name is overridden by name_override, then name_prefix and name_suffix
+// are added.  Tags already set on the metric are kept, missing ones are taken
+// from the plugin [tags] table first and from the global tags, including the
+// host tag, second.
 func (r *RunningInput) MakeMetric(metric pip.Metric) pip.Metric {
-	return metric
+	if ok := r.Config.Filter.Select(metric); !ok {
+		r.metricFiltered(metric)
+		return nil
+	}
+
+	m := makemetric(
+		metric,
+		r.Config.NameOverride,
+		r.Config.MeasurementPrefix,
+		r.Config.MeasurementSuffix,
+		r.Config.Tags,
+		r.defaultTags)
+
+	r.Config.Filter.Modify(m)
+	if len(m.FieldList()) == 0 {
+		r.metricFiltered(m)
+		return nil
+	}
+
+	r.MetricsGathered.Incr(1)
+	AgentMetricsGathered.Incr(1)
+	return m
+}
+
+func (r *RunningInput) metricFiltered(metric pip.Metric) {
+	r.MetricsFiltered.Incr(1)
+	metric.Drop()
 }
 
 // Log ...
 func (r *RunningInput) Log() pip.Logger {
-	return nil
+	return r.log
 }
 
 // Init ...
@@ -36,16 +79,69 @@ func (r *RunningInput) Init() error {
 
 // NewRunningInput ...
 func NewRunningInput(input pip.Input, config *InputConfig) *RunningInput {
+	tags := map[string]string{"input": config.Name}
+	if config.Alias != "" {
+		tags["alias"] = config.Alias
+	}
+	if config.Pipeline != "" {
+		tags["pipeline"] = config.Pipeline
+	}
+
+	gatherErrors := metrics.Register("gather", "errors", tags)
+	logger := NewLogger(config.Pipeline, "inputs", config.Name, config.Alias)
+	logger.OnErr(func() {
+		gatherErrors.Incr(1)
+		AgentGatherErrors.Incr(1)
+	})
+	SetLoggerOnPlugin(input, logger)
+
 	return &RunningInput{
 		Input:  input,
 		Config: config,
+		log:    logger,
+		MetricsGathered: metrics.Register(
+			"gather",
+			"metrics_gathered",
+			tags,
+		),
+		MetricsFiltered: metrics.Register(
+			"gather",
+			"metrics_filtered",
+			tags,
+		),
+		GatherTime: metrics.RegisterTiming(
+			"gather",
+			"gather_time_ns",
+			tags,
+		),
+		GatherErrors: gatherErrors,
 	}
 }
 
 // InputConfig is the common config for all inputs.
 type InputConfig struct {
-	Name string
-	Tags map[string]string
+	Name  string
+	Alias string
+	// Pipeline is the name of the pipeline of the plugin, empty for the
+	// default pipeline.
+	Pipeline         string
+	Interval         time.Duration
+	CollectionJitter time.Duration
+	Tags             map[string]string
+	Filter           Filter
+
+	NameOverride      string
+	MeasurementPrefix string
+	MeasurementSuffix string
+}
+
+// Gather runs the Gather function of the input plugin.
+func (r *RunningInput) Gather(acc pip.Accumulator) error {
+	start := time.Now()
+	err := r.Input.Gather(acc)
+	elapsed := time.Since(start)
+	r.GatherTime.Incr(elapsed.Nanoseconds())
+	return err
 }
 
 // SetDefaultTags ...
@@ -1,17 +1,92 @@
 package models
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"ezreal.com.cn/pip/metrics"
 	"ezreal.com.cn/pip/pip"
 )
 
+const (
+	// DefaultMetricBatchSize is the default size of metrics batch size.
+	DefaultMetricBatchSize = 1000
+
+	// DefaultMetricBufferLimit is the default number of metrics kept. It
+	// should be a multiple of batch size.
+	DefaultMetricBufferLimit = 10000
+)
+
+// Output startup error behaviors.
+const (
+	// StartupErrorError fails agent startup when the output cannot connect.
+	StartupErrorError = "error"
+
+	// StartupErrorRetry keeps connecting in the background while the agent
+	// runs, buffering metrics until the output is connected.
+	StartupErrorRetry = "retry"
+)
+
+// ErrNotConnected is returned by writes to an output that has not connected.
+var ErrNotConnected = errors.New("output is not connected")
+
+// OutputConfig containing name, filter and buffer settings
+type OutputConfig struct {
+	Name  string
+	Alias string
+	// Pipeline is the name of the pipeline of the plugin, empty for the
+	// default pipeline.
+	Pipeline string
+	Filter   Filter
+
+	FlushInterval     time.Duration
+	FlushJitter       *time.Duration
+	MetricBufferLimit int
+	MetricBatchSize   int
+
+	// StartupErrorBehavior overrides the agent output_startup_error_behavior.
+	StartupErrorBehavior string
+
+	// BufferStrategy is either "memory" or "disk", a disk buffer is stored
+	// in BufferDirectory and uses at most BufferMaxSize bytes when positive.
+	BufferStrategy  string
+	BufferDirectory string
+	BufferMaxSize   int64
+}
+
+// ID returns the name of the output followed by its alias, it names the files
+// the output keeps on disk.
+func (c *OutputConfig) ID() string {
+	if c.Alias == "" {
+		return c.Name
+	}
+	return c.Name + "-" + c.Alias
+}
+
 // RunningOutput contains the output configuration
 type RunningOutput struct {
-	Output pip.Output
 	// Must be 64-bit aligned
 	newMetricsCount int64
 	droppedMetrics  int64
+	connected       int32
+
+	Output            pip.Output
+	Config            *OutputConfig
+	MetricBufferLimit int
+	MetricBatchSize   int
+
+	MetricsFiltered metrics.Stat
+	WriteTime       metrics.Stat
+	WriteErrors     metrics.Stat
+
+	// BatchReady receives a value each time a full batch is available in
+	// the buffer.
+	BatchReady chan time.Time
+
+	buffer Buffer
+	log    pip.Logger
 
 	aggMutex sync.Mutex
 }
@@ -24,17 +99,214 @@ func (r *RunningOutput) Init() error {
 	return nil
 }
 
-// NewRunningOutput ....
-func NewRunningOutput(output pip.Output) *RunningOutput {
+// NewRunningOutput returns a RunningOutput; batchSize and bufferLimit are the
+// agent wide defaults and are overridden by the values set in config.
+func NewRunningOutput(
+	output pip.Output,
+	config *OutputConfig,
+	batchSize int,
+	bufferLimit int,
+) *RunningOutput {
+	if config.MetricBufferLimit > 0 {
+		bufferLimit = config.MetricBufferLimit
+	}
+	if bufferLimit == 0 {
+		bufferLimit = DefaultMetricBufferLimit
+	}
+	if config.MetricBatchSize > 0 {
+		batchSize = config.MetricBatchSize
+	}
+	if batchSize == 0 {
+		batchSize = DefaultMetricBatchSize
+	}
+
+	tags := map[string]string{"output": config.Name}
+	if config.Alias != "" {
+		tags["alias"] = config.Alias
+	}
+	if config.Pipeline != "" {
+		tags["pipeline"] = config.Pipeline
+	}
+
+	logger := NewLogger(config.Pipeline, "outputs", config.Name, config.Alias)
+	SetLoggerOnPlugin(output, logger)
+
 	return &RunningOutput{
-		Output: output,
+		log:               logger,
+		Output:            output,
+		Config:            config,
+		MetricBufferLimit: bufferLimit,
+		MetricBatchSize:   batchSize,
+		BatchReady:        make(chan time.Time, 1),
+		buffer:            NewBuffer(config, bufferLimit, logger),
+		MetricsFiltered: metrics.Register(
+			"write",
+			"metrics_filtered",
+			tags,
+		),
+		WriteTime: metrics.RegisterTiming(
+			"write",
+			"write_time_ns",
+			tags,
+		),
+		WriteErrors: metrics.Register(
+			"write",
+			"errors",
+			tags,
+		),
+	}
+}
+
+// LogName returns the name used to identify the output in log lines.
+func (r *RunningOutput) LogName() string {
+	return logName(r.Config.Pipeline, "outputs", r.Config.Name, r.Config.Alias)
+}
+
+// Log returns the logger of the output.
+func (r *RunningOutput) Log() pip.Logger {
+	return r.log
+}
+
+// OpenBuffer opens the metric buffer of the output, metrics persisted by a
+// disk buffer are loaded to be written again.
+func (r *RunningOutput) OpenBuffer() error {
+	return r.buffer.Open()
+}
+
+// Connect connects the output plugin and marks it ready for writing.
+func (r *RunningOutput) Connect() error {
+	err := r.Output.Connect()
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&r.connected, 1)
+	return nil
+}
+
+// Connected returns true once Connect has succeeded.
+func (r *RunningOutput) Connected() bool {
+	return atomic.LoadInt32(&r.connected) == 1
+}
+
+// Close closes the output and its buffer
+func (r *RunningOutput) Close() {
+	if atomic.CompareAndSwapInt32(&r.connected, 1, 0) {
+		err := r.Output.Close()
+		if err != nil {
+			r.log.Errorf("Error closing output: %v", err)
+		}
+	}
+
+	if err := r.buffer.Close(); err != nil {
+		r.log.Errorf("Error closing buffer: %v", err)
 	}
 }
 
-// AddMetric ...
 // AddMetric adds a metric to the output.
 //
 // Takes ownership of metric
 func (r *RunningOutput) AddMetric(metric pip.Metric) {
-	r.Output.Write([]pip.Metric{metric})
+	if ok := r.Config.Filter.Select(metric); !ok {
+		r.metricFiltered(metric)
+		return
+	}
+
+	r.Config.Filter.Modify(metric)
+	if len(metric.FieldList()) == 0 {
+		r.metricFiltered(metric)
+		return
+	}
+
+	dropped := r.buffer.Add(metric)
+	atomic.AddInt64(&r.droppedMetrics, int64(dropped))
+
+	count := atomic.AddInt64(&r.newMetricsCount, 1)
+	if count == int64(r.MetricBatchSize) {
+		atomic.StoreInt64(&r.newMetricsCount, 0)
+		select {
+		case r.BatchReady <- time.Now():
+		default:
+		}
+	}
+}
+
+func (r *RunningOutput) metricFiltered(metric pip.Metric) {
+	r.MetricsFiltered.Incr(1)
+	metric.Drop()
+}
+
+// Write writes all metrics to the output, stopping when all have been sent on
+// or error.
+func (r *RunningOutput) Write() error {
+	atomic.StoreInt64(&r.newMetricsCount, 0)
+
+	// Only process the metrics in the buffer now.  Metrics added while we are
+	// writing will be sent on the next call.
+	nBuffer := r.buffer.Len()
+	nBatches := nBuffer/r.MetricBatchSize + 1
+	for i := 0; i < nBatches; i++ {
+		batch := r.buffer.Batch(r.MetricBatchSize)
+		if len(batch) == 0 {
+			break
+		}
+
+		err := r.write(batch)
+		if err != nil {
+			r.buffer.Reject(batch)
+			return err
+		}
+		r.buffer.Accept(batch)
+	}
+	return nil
+}
+
+// WriteBatch writes a single batch of metrics to the output.
+func (r *RunningOutput) WriteBatch() error {
+	batch := r.buffer.Batch(r.MetricBatchSize)
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := r.write(batch)
+	if err != nil {
+		r.buffer.Reject(batch)
+		return err
+	}
+	r.buffer.Accept(batch)
+
+	return nil
+}
+
+func (r *RunningOutput) write(metrics []pip.Metric) error {
+	if !r.Connected() {
+		return ErrNotConnected
+	}
+
+	dropped := atomic.LoadInt64(&r.droppedMetrics)
+	if dropped > 0 {
+		r.log.Warnf("Metric buffer overflow; %d metrics have been dropped", dropped)
+		atomic.StoreInt64(&r.droppedMetrics, 0)
+	}
+
+	start := time.Now()
+	err := r.Output.Write(metrics)
+	elapsed := time.Since(start)
+	r.WriteTime.Incr(elapsed.Nanoseconds())
+
+	if err != nil {
+		r.WriteErrors.Incr(1)
+	} else {
+		r.log.Debugf("Wrote batch of %d metrics in %s", len(metrics), elapsed)
+	}
+	return err
+}
+
+// LogBufferStatus logs the number of metrics currently held by the buffer.
+func (r *RunningOutput) LogBufferStatus() {
+	nBuffer := r.buffer.Len()
+	if r.Config.BufferStrategy == BufferStrategyDisk {
+		r.log.Debugf("Buffer fullness: %d metrics on disk", nBuffer)
+		return
+	}
+	r.log.Debugf("Buffer fullness: %d / %d metrics", nBuffer, r.MetricBufferLimit)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sync"
 
+	"ezreal.com.cn/pip/metrics"
 	"ezreal.com.cn/pip/pip"
 )
 
@@ -12,23 +13,67 @@ import (
 type ProcessorConfig struct {
 	Name  string
 	Alias string
-	Order int64
+	// Pipeline is the name of the pipeline of the plugin, empty for the
+	// default pipeline.
+	Pipeline string
+	Order    int64
+	Filter   Filter
 }
 
 // RunningProcessor ...
 type RunningProcessor struct {
-	Processor pip.StreamingProcessor
 	sync.Mutex
+	log       pip.Logger
+	Processor pip.StreamingProcessor
+	Config    *ProcessorConfig
+
+	MetricsFiltered metrics.Stat
+	Errors          metrics.Stat
+}
+
+// unwrappable is implemented by processors wrapping a pip.Processor, such as
+// the streaming processor adapter.
+type unwrappable interface {
+	Unwrap() pip.Processor
 }
 
 // RunningProcessors ...
 type RunningProcessors []*RunningProcessor
 
+func (rp RunningProcessors) Len() int           { return len(rp) }
+func (rp RunningProcessors) Swap(i, j int)      { rp[i], rp[j] = rp[j], rp[i] }
+func (rp RunningProcessors) Less(i, j int) bool { return rp[i].Config.Order < rp[j].Config.Order }
+
 // NewRunningProcessor ...
-func NewRunningProcessor(processor pip.StreamingProcessor) *RunningProcessor {
+func NewRunningProcessor(processor pip.StreamingProcessor, config *ProcessorConfig) *RunningProcessor {
+	tags := map[string]string{"processor": config.Name}
+	if config.Alias != "" {
+		tags["alias"] = config.Alias
+	}
+	if config.Pipeline != "" {
+		tags["pipeline"] = config.Pipeline
+	}
+
+	processErrors := metrics.Register("process", "errors", tags)
+	logger := NewLogger(config.Pipeline, "processors", config.Name, config.Alias)
+	logger.OnErr(func() {
+		processErrors.Incr(1)
+	})
+	SetLoggerOnPlugin(processor, logger)
+	if p, ok := processor.(unwrappable); ok {
+		SetLoggerOnPlugin(p.Unwrap(), logger)
+	}
 
 	return &RunningProcessor{
 		Processor: processor,
+		Config:    config,
+		log:       logger,
+		MetricsFiltered: metrics.Register(
+			"process",
+			"metrics_filtered",
+			tags,
+		),
+		Errors: processErrors,
 	}
 }
 
@@ -42,12 +87,12 @@ func (r *RunningProcessor) Init() error {
 
 // Log ...
 func (r *RunningProcessor) Log() pip.Logger {
-	return nil
+	return r.log
 }
 
 // LogName ...
 func (r *RunningProcessor) LogName() string {
-	return ""
+	return logName(r.Config.Pipeline, "processors", r.Config.Name, r.Config.Alias)
 }
 
 // MakeMetric ...
@@ -65,18 +110,23 @@ func (r *RunningProcessor) Stop() {
 }
 
 func (r *RunningProcessor) Add(m pip.Metric, acc pip.Accumulator) error {
-	// if ok := r.Config.Filter.Select(m); !ok {
-	// 	// pass downstream
-	// 	acc.AddMetric(m)
-	// 	return nil
-	// }
-
-	// r.Config.Filter.Modify(m)
-	// if len(m.FieldList()) == 0 {
-	// 	// drop metric
-	// 	r.metricFiltered(m)
-	// 	return nil
-	// }
+	if ok := r.Config.Filter.Select(m); !ok {
+		// pass downstream
+		acc.AddMetric(m)
+		return nil
+	}
+
+	r.Config.Filter.Modify(m)
+	if len(m.FieldList()) == 0 {
+		// drop metric
+		r.metricFiltered(m)
+		return nil
+	}
 
 	return r.Processor.Add(m, acc)
 }
+
+func (r *RunningProcessor) metricFiltered(metric pip.Metric) {
+	r.MetricsFiltered.Incr(1)
+	metric.Drop()
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"ezreal.com.cn/pip/metrics"
+)
+
+// Agent wide stats, the per plugin stats are registered by the running
+// plugins.
+var (
+	AgentMetricsGathered = metrics.Register("agent", "metrics_gathered", map[string]string{})
+	AgentGatherErrors    = metrics.Register("agent", "gather_errors", map[string]string{})
+	AgentMetricsWritten  = metrics.Register("agent", "metrics_written", map[string]string{})
+	AgentMetricsDropped  = metrics.Register("agent", "metrics_dropped", map[string]string{})
+)
@@ -1,5 +1,6 @@
 package all
 
 import (
+	_ "ezreal.com.cn/pip/pip/output/http"
 	_ "ezreal.com.cn/pip/pip/output/simple"
 )
@@ -0,0 +1,252 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/config"
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+// loadOutput loads the config and returns its single http output.
+func loadOutput(t *testing.T, data string) *HTTP {
+	t.Helper()
+	c := config.NewConfig()
+	if err := c.LoadConfigData([]byte(data)); err != nil {
+		t.Fatalf("LoadConfigData() error = %v", err)
+	}
+	if len(c.Outputs) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(c.Outputs))
+	}
+	return c.Outputs[0].Output.(*HTTP)
+}
+
+func TestPasswordRedacted(t *testing.T) {
+	os.Setenv("PIP_TEST_HTTP_PASSWORD", "env-s3cr3t-word")
+	defer os.Unsetenv("PIP_TEST_HTTP_PASSWORD")
+
+	tests := []struct {
+		name     string
+		password string
+		value    string
+	}{
+		{name: "literal", password: `"s3cr3t-word"`, value: "s3cr3t-word"},
+		{name: "env reference", password: `"@{env:PIP_TEST_HTTP_PASSWORD}"`, value: "env-s3cr3t-word"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := loadOutput(t, `
+[[outputs.http]]
+  data_format = "json"
+  username = "pip"
+  password = `+tt.password+"\n")
+
+			for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+				if s := fmt.Sprintf(format, h); strings.Contains(s, tt.value) {
+					t.Errorf("%s of the output shows the password: %s", format, s)
+				}
+				if s := fmt.Sprintf(format, h.Password); strings.Contains(s, tt.value) {
+					t.Errorf("%s of the secret shows the password: %s", format, s)
+				}
+			}
+
+			password, err := h.Password.Get()
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if string(password) != tt.value {
+				t.Errorf("Get() = %q, want %q", password, tt.value)
+			}
+		})
+	}
+}
+
+func TestWriteBasicAuth(t *testing.T) {
+	var username, password, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ = r.BasicAuth()
+		buf := make([]byte, 1024)
+		n, _ := r.Body.Read(buf)
+		body = string(buf[:n])
+	}))
+	defer ts.Close()
+
+	h := loadOutput(t, `
+[[outputs.http]]
+  url = "`+ts.URL+`"
+  data_format = "json"
+  username = "pip"
+  password = "s3cr3t-word"
+`)
+	if err := h.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	m, _ := metric.New("cpu", nil, map[string]interface{}{"value": 42}, time.Unix(0, 0))
+	if err := h.Write([]pip.Metric{m}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if username != "pip" || password != "s3cr3t-word" {
+		t.Errorf("got basic auth %q:%q, want %q:%q", username, password, "pip", "s3cr3t-word")
+	}
+	if want := `{"metrics":[{"fields":{"value":42},"name":"cpu","tags":{},"timestamp":0}]}`; body != want {
+		t.Errorf("got body %s, want %s", body, want)
+	}
+}
+
+// writeMetric connects the output and writes a single metric.
+func writeMetric(t *testing.T, h *HTTP) error {
+	t.Helper()
+	if err := h.Connect(); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	m, _ := metric.New("cpu", nil, map[string]interface{}{"value": 42}, time.Unix(0, 0))
+	return h.Write([]pip.Metric{m})
+}
+
+func TestWriteContentEncoding(t *testing.T) {
+	var encoding, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		buf, _ := ioutil.ReadAll(zr)
+		body = string(buf)
+	}))
+	defer ts.Close()
+
+	h := loadOutput(t, `
+[[outputs.http]]
+  url = "`+ts.URL+`"
+  data_format = "json"
+  content_encoding = "gzip"
+`)
+	if err := writeMetric(t, h); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if encoding != "gzip" {
+		t.Errorf("got Content-Encoding %q, want %q", encoding, "gzip")
+	}
+	if !strings.Contains(body, `"name":"cpu"`) {
+		t.Errorf("got body %s, want the cpu metric", body)
+	}
+
+	h = loadOutput(t, `
+[[outputs.http]]
+  data_format = "json"
+  content_encoding = "br"
+`)
+	if err := h.Connect(); err == nil || !strings.Contains(err.Error(), `invalid content_encoding "br"`) {
+		t.Errorf("Connect() error = %v, want an invalid content_encoding error", err)
+	}
+}
+
+func TestWriteOAuth2(t *testing.T) {
+	os.Setenv("PIP_TEST_HTTP_CLIENT_SECRET", "client-s3cr3t")
+	defer os.Unsetenv("PIP_TEST_HTTP_CLIENT_SECRET")
+
+	var tokenRequests int
+	var clientID, clientSecret, grant, scope, auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokenRequests++
+			clientID, clientSecret, _ = r.BasicAuth()
+			grant, scope = r.FormValue("grant_type"), r.FormValue("scope")
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"t0k3n","token_type":"bearer","expires_in":3600}`)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	h := loadOutput(t, `
+[[outputs.http]]
+  url = "`+ts.URL+`/write"
+  data_format = "json"
+  client_id = "pip"
+  client_secret = "@{env:PIP_TEST_HTTP_CLIENT_SECRET}"
+  token_url = "`+ts.URL+`/token"
+  scopes = ["read", "write"]
+`)
+	if s := fmt.Sprintf("%+v", h); strings.Contains(s, "client-s3cr3t") {
+		t.Errorf("%%+v of the output shows the client secret: %s", s)
+	}
+	if err := writeMetric(t, h); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	m, _ := metric.New("cpu", nil, map[string]interface{}{"value": 43}, time.Unix(1, 0))
+	if err := h.Write([]pip.Metric{m}); err != nil {
+		t.Fatalf("second Write() error = %v", err)
+	}
+	if clientID != "pip" || clientSecret != "client-s3cr3t" {
+		t.Errorf("got client credentials %q:%q, want %q:%q", clientID, clientSecret, "pip", "client-s3cr3t")
+	}
+	if grant != "client_credentials" || scope != "read write" {
+		t.Errorf("got grant_type %q and scope %q, want %q and %q", grant, scope, "client_credentials", "read write")
+	}
+	if auth != "Bearer t0k3n" {
+		t.Errorf("got Authorization %q, want %q", auth, "Bearer t0k3n")
+	}
+	if tokenRequests != 1 {
+		t.Errorf("got %d token requests, want the token cached", tokenRequests)
+	}
+}
+
+func TestWriteTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(ca, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "unknown authority", wantErr: "certificate"},
+		{name: "tls_ca", config: `tls_ca = "` + filepath.ToSlash(ca) + `"`},
+		{name: "insecure_skip_verify", config: "insecure_skip_verify = true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := loadOutput(t, `
+[[outputs.http]]
+  url = "`+ts.URL+`"
+  data_format = "json"
+  `+tt.config+"\n")
+			err := writeMetric(t, h)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Write() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+// expiryDelta renews tokens a bit early so that they don't expire in flight.
+const expiryDelta = 10 * time.Second
+
+// clientCredentials fetches the tokens of the OAuth2 client credentials grant
+// and caches them until they expire.
+type clientCredentials struct {
+	client       *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret pip.Secret
+	scopes       []string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Token returns a valid access token, requesting a new one when needed.
+func (c *clientCredentials) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || time.Now().Before(c.expiry)) {
+		return c.token, nil
+	}
+
+	// the secret is read on each request so that a rotated one is used
+	secret, err := c.clientSecret.Get()
+	if err != nil {
+		return "", fmt.Errorf("reading client_secret: %w", err)
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) > 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+	req, err := http.NewRequest(http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(string(secret)))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading token: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("when requesting token from [%s] received status code: %d", c.tokenURL, resp.StatusCode)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("parsing token: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("token response from [%s] has no access_token", c.tokenURL)
+	}
+
+	c.token = tok.AccessToken
+	c.expiry = time.Time{}
+	if tok.ExpiresIn > 0 {
+		c.expiry = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - expiryDelta)
+	}
+	return c.token, nil
+}
@@ -0,0 +1,129 @@
+package pip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/influxdata/toml"
+)
+
+// redacted replaces the value of a Secret wherever it would be printed.
+const redacted = "<redacted>"
+
+// secretRefRe matches references to secrets held outside of the config.
+var secretRefRe = regexp.MustCompile(`^@\{(\w+):(.*)\}$`)
+
+// Secret is a config value that is only revealed by Get and is never
+// printed. Its value is either a literal string or one of the references:
+//
+//	@{file:/run/secrets/db_pass}   the content of the file
+//	@{env:NAME}                    the environment variable NAME
+//	@{store:vault_name:key}        key of the secret store with id vault_name
+//
+// References are resolved when the plugin is loaded, and again on each Get
+// so that rotated secrets are picked up.
+type Secret struct {
+	// the pointer keeps the value out of %+v output of the enclosing plugin
+	s *secret
+}
+
+type secret struct {
+	ref     string
+	resolve func() ([]byte, error)
+}
+
+// UnmarshalTOML reads the literal or reference from the TOML string.
+func (s *Secret) UnmarshalTOML(b []byte) error {
+	var v struct {
+		Value string `toml:"value"`
+	}
+	if err := toml.Unmarshal(append([]byte("value = "), b...), &v); err != nil {
+		return fmt.Errorf("secret must be a string")
+	}
+	s.s = &secret{ref: v.Value}
+	return nil
+}
+
+// Get returns the value of the secret.
+func (s Secret) Get() ([]byte, error) {
+	if s.s == nil {
+		return nil, nil
+	}
+	if s.s.resolve == nil {
+		if err := s.Link(nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.s.resolve()
+}
+
+// Format prints the secret redacted for every verb.
+func (s Secret) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redacted)
+}
+
+// MarshalText keeps the secret redacted in encoded output.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// Link sets up the resolution of the secret reference and resolves it once
+// to report missing secrets at load time, it is called by the config loader
+// with the configured secret stores.
+func (s Secret) Link(stores map[string]SecretStore) error {
+	if s.s == nil {
+		return nil
+	}
+
+	m := secretRefRe.FindStringSubmatch(s.s.ref)
+	if m == nil {
+		value := []byte(s.s.ref)
+		s.s.resolve = func() ([]byte, error) { return value, nil }
+		return nil
+	}
+
+	kind, ref := m[1], m[2]
+	switch kind {
+	case "file":
+		s.s.resolve = func() ([]byte, error) {
+			value, err := ioutil.ReadFile(ref)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.TrimRight(value, "\r\n"), nil
+		}
+	case "env":
+		s.s.resolve = func() ([]byte, error) {
+			value, ok := os.LookupEnv(ref)
+			if !ok {
+				return nil, fmt.Errorf("environment variable %s is not set", ref)
+			}
+			return []byte(value), nil
+		}
+	case "store":
+		parts := strings.SplitN(ref, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid reference %q, expected @{store:<id>:<key>}", s.s.ref)
+		}
+		store, ok := stores[parts[0]]
+		if !ok {
+			return fmt.Errorf("unknown secret store %q", parts[0])
+		}
+		key := parts[1]
+		s.s.resolve = func() ([]byte, error) {
+			return store.Get(key)
+		}
+	default:
+		return fmt.Errorf("unknown secret reference %q", s.s.ref)
+	}
+
+	if _, err := s.s.resolve(); err != nil {
+		return fmt.Errorf("resolving %s: %w", s.s.ref, err)
+	}
+	return nil
+}
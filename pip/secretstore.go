@@ -0,0 +1,20 @@
+package pip
+
+// SecretStore is an interface for implementing a secret store plugin, the
+// secrets it holds are referenced as @{store:<id>:<key>} in the config.
+type SecretStore interface {
+	PluginDescriber
+
+	// Init performs one time setup of the store and returns an error if the
+	// configuration is invalid.
+	Init() error
+
+	// Get returns the secret stored under key.
+	Get(key string) ([]byte, error)
+
+	// Set stores value under key.
+	Set(key, value string) error
+
+	// List returns the keys of all stored secrets.
+	List() ([]string, error)
+}
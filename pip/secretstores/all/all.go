@@ -0,0 +1,7 @@
+package all
+
+import (
+	_ "ezreal.com.cn/pip/pip/secretstores/env"
+	_ "ezreal.com.cn/pip/pip/secretstores/file"
+	_ "ezreal.com.cn/pip/pip/secretstores/keyfile"
+)
@@ -0,0 +1,72 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/secretstores"
+)
+
+// Env reads secrets from environment variables.
+type Env struct {
+	Prefix string `toml:"prefix"`
+}
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as
+  ## @{store:<id>:<key>}
+  id = "env"
+
+  ## Prefix prepended to the key to form the variable name
+  # prefix = "PIP_SECRET_"
+`
+
+// SampleConfig ...
+func (e *Env) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description ...
+func (e *Env) Description() string {
+	return "Read secrets from environment variables"
+}
+
+// Init ...
+func (e *Env) Init() error {
+	return nil
+}
+
+// Get ...
+func (e *Env) Get(key string) ([]byte, error) {
+	value, ok := os.LookupEnv(e.Prefix + key)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s%s is not set", e.Prefix, key)
+	}
+	return []byte(value), nil
+}
+
+// Set ...
+func (e *Env) Set(key, value string) error {
+	return errors.New("the env secret store is read-only")
+}
+
+// List ...
+func (e *Env) List() ([]string, error) {
+	var keys []string
+	for _, kv := range os.Environ() {
+		name := kv[:strings.IndexByte(kv, '=')]
+		if e.Prefix != "" && strings.HasPrefix(name, e.Prefix) {
+			keys = append(keys, strings.TrimPrefix(name, e.Prefix))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func init() {
+	secretstores.Add("env", func() pip.SecretStore { return &Env{} })
+}
@@ -0,0 +1,105 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/secretstores"
+)
+
+// File reads secrets from the files of a directory, one secret per file
+// named after its key, as mounted by Docker or Kubernetes.
+type File struct {
+	Directory string `toml:"directory" required:"true"`
+}
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as
+  ## @{store:<id>:<key>}
+  id = "files"
+
+  ## Directory holding one file per secret
+  directory = "/run/secrets"
+`
+
+// SampleConfig ...
+func (f *File) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description ...
+func (f *File) Description() string {
+	return "Read secrets from the files of a directory"
+}
+
+// Init ...
+func (f *File) Init() error {
+	if f.Directory == "" {
+		return errors.New("directory is required")
+	}
+	info, err := os.Stat(f.Directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", f.Directory)
+	}
+	return nil
+}
+
+// path returns the file of the key, keys may not leave the directory.
+func (f *File) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid secret key %q", key)
+	}
+	return filepath.Join(f.Directory, key), nil
+}
+
+// Get ...
+func (f *File) Get(key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(value, "\r\n"), nil
+}
+
+// Set ...
+func (f *File) Set(key, value string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(value), 0600)
+}
+
+// List ...
+func (f *File) List() ([]string, error) {
+	files, err := ioutil.ReadDir(f.Directory)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, file := range files {
+		if file.Mode().IsRegular() && !strings.HasPrefix(file.Name(), ".") {
+			keys = append(keys, file.Name())
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func init() {
+	secretstores.Add("file", func() pip.SecretStore { return &File{} })
+}
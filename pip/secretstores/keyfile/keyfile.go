@@ -0,0 +1,250 @@
+package keyfile
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/secretstores"
+)
+
+const (
+	saltSize   = 16
+	keySize    = 32
+	iterations = 100000
+)
+
+// Keyfile keeps secrets in a local file encrypted with AES-256-GCM, the key
+// is derived from the password with PBKDF2-HMAC-SHA256.
+type Keyfile struct {
+	Path     string     `toml:"path" required:"true"`
+	Password pip.Secret `toml:"password"`
+
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// file is the on-disk layout of the keyfile.
+type file struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+var sampleConfig = `
+  ## Unique identifier of the store, secrets are referenced as
+  ## @{store:<id>:<key>}
+  id = "vault_name"
+
+  ## File holding the encrypted secrets, it is created on the first
+  ## "pip secrets set"
+  path = "/etc/pip/secrets.keyfile"
+
+  ## Password the encryption key is derived from
+  password = "@{env:PIP_KEYFILE_PASSWORD}"
+`
+
+// SampleConfig ...
+func (k *Keyfile) SampleConfig() string {
+	return sampleConfig
+}
+
+// Description ...
+func (k *Keyfile) Description() string {
+	return "Keep secrets in an encrypted local file"
+}
+
+// Init ...
+func (k *Keyfile) Init() error {
+	if k.Path == "" {
+		return errors.New("path is required")
+	}
+	password, err := k.Password.Get()
+	if err != nil {
+		return err
+	}
+	if len(password) == 0 {
+		return errors.New("password is required")
+	}
+
+	k.secrets, err = k.load(password)
+	return err
+}
+
+// load decrypts the keyfile, a missing file holds no secrets.
+func (k *Keyfile) load(password []byte) (map[string]string, error) {
+	secrets := make(map[string]string)
+
+	buf, err := ioutil.ReadFile(k.Path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", k.Path, err)
+	}
+
+	gcm, err := newGCM(password, f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: wrong password or corrupted file", k.Path)
+	}
+
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", k.Path, err)
+	}
+	return secrets, nil
+}
+
+// save encrypts the secrets with a fresh salt and nonce and replaces the
+// keyfile.
+func (k *Keyfile) save(secrets map[string]string) error {
+	password, err := k.Password.Get()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	f := file{Salt: make([]byte, saltSize)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(password, f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, data, nil)
+
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(k.Path), ".keyfile")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), k.Path)
+}
+
+// Get ...
+func (k *Keyfile) Get(key string) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	value, ok := k.secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %q not found", key)
+	}
+	return []byte(value), nil
+}
+
+// Set ...
+func (k *Keyfile) Set(key, value string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets := make(map[string]string, len(k.secrets)+1)
+	for name, v := range k.secrets {
+		secrets[name] = v
+	}
+	secrets[key] = value
+
+	if err := k.save(secrets); err != nil {
+		return err
+	}
+	k.secrets = secrets
+	return nil
+}
+
+// List ...
+func (k *Keyfile) List() ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make([]string, 0, len(k.secrets))
+	for key := range k.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func newGCM(password, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2(password, salt, iterations, keySize))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key of keyLen bytes from the password as of RFC 8018
+// with HMAC-SHA256 as the pseudorandom function.
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for x := range u {
+				t[x] ^= u[x]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
+
+func init() {
+	secretstores.Add("keyfile", func() pip.SecretStore { return &Keyfile{} })
+}
@@ -0,0 +1,11 @@
+package secretstores
+
+import "ezreal.com.cn/pip/pip"
+
+type Creator func() pip.SecretStore
+
+var SecretStores = map[string]Creator{}
+
+func Add(name string, creator Creator) {
+	SecretStores[name] = creator
+}
@@ -0,0 +1,79 @@
+package json
+
+import (
+	"encoding/json"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+)
+
+// Serializer writes metrics as JSON objects with their name, tags, fields
+// and timestamp.
+type Serializer struct {
+	TimestampUnits time.Duration
+}
+
+// NewSerializer returns a Serializer writing timestamps in timestampUnits,
+// truncated to a power of ten and defaulting to seconds.
+func NewSerializer(timestampUnits time.Duration) (*Serializer, error) {
+	return &Serializer{
+		TimestampUnits: truncateDuration(timestampUnits),
+	}, nil
+}
+
+// Serialize ...
+func (s *Serializer) Serialize(metric pip.Metric) ([]byte, error) {
+	m := s.createObject(metric)
+	serialized, err := json.Marshal(m)
+	if err != nil {
+		return []byte{}, err
+	}
+	serialized = append(serialized, '\n')
+
+	return serialized, nil
+}
+
+// SerializeBatch writes the metrics as the array under the "metrics" key of
+// a single object.
+func (s *Serializer) SerializeBatch(metrics []pip.Metric) ([]byte, error) {
+	objects := make([]interface{}, 0, len(metrics))
+	for _, metric := range metrics {
+		m := s.createObject(metric)
+		objects = append(objects, m)
+	}
+
+	obj := map[string]interface{}{
+		"metrics": objects,
+	}
+
+	serialized, err := json.Marshal(obj)
+	if err != nil {
+		return []byte{}, err
+	}
+	return serialized, nil
+}
+
+func (s *Serializer) createObject(metric pip.Metric) map[string]interface{} {
+	m := make(map[string]interface{}, 4)
+	m["tags"] = metric.Tags()
+	m["fields"] = metric.Fields()
+	m["name"] = metric.Name()
+	m["timestamp"] = metric.Time().UnixNano() / int64(s.TimestampUnits)
+	return m
+}
+
+func truncateDuration(units time.Duration) time.Duration {
+	// Default precision is 1s
+	if units <= 0 {
+		return time.Second
+	}
+
+	// Search for the power of ten less than the duration
+	d := time.Nanosecond
+	for {
+		if d*10 > units {
+			return d
+		}
+		d = d * 10
+	}
+}
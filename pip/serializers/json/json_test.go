@@ -0,0 +1,60 @@
+package json
+
+import (
+	"testing"
+	"time"
+
+	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/metric"
+)
+
+func TestSerialize(t *testing.T) {
+	tm := time.Unix(1600000000, 123456789)
+	m, err := metric.New("cpu", map[string]string{"host": "a"}, map[string]interface{}{"usage": 1.5}, tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		units time.Duration
+		want  string
+	}{
+		{name: "default seconds", want: `{"fields":{"usage":1.5},"name":"cpu","tags":{"host":"a"},"timestamp":1600000000}` + "\n"},
+		{name: "milliseconds", units: time.Millisecond,
+			want: `{"fields":{"usage":1.5},"name":"cpu","tags":{"host":"a"},"timestamp":1600000000123}` + "\n"},
+		{name: "truncated to a power of ten", units: 5 * time.Millisecond,
+			want: `{"fields":{"usage":1.5},"name":"cpu","tags":{"host":"a"},"timestamp":1600000000123}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := NewSerializer(tt.units)
+			got, err := s.Serialize(m)
+			if err != nil {
+				t.Fatalf("Serialize() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Serialize() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializeBatch(t *testing.T) {
+	var metrics []pip.Metric
+	for i := 0; i < 2; i++ {
+		m, _ := metric.New("cpu", nil, map[string]interface{}{"value": i}, time.Unix(int64(i), 0))
+		metrics = append(metrics, m)
+	}
+
+	s, _ := NewSerializer(0)
+	got, err := s.SerializeBatch(metrics)
+	if err != nil {
+		t.Fatalf("SerializeBatch() error = %v", err)
+	}
+	want := `{"metrics":[{"fields":{"value":0},"name":"cpu","tags":{},"timestamp":0},` +
+		`{"fields":{"value":1},"name":"cpu","tags":{},"timestamp":1}]}`
+	if string(got) != want {
+		t.Errorf("SerializeBatch() = %s, want %s", got, want)
+	}
+}
@@ -2,8 +2,10 @@ package serializers
 
 import (
 	"fmt"
+	"time"
 
 	"ezreal.com.cn/pip/pip"
+	"ezreal.com.cn/pip/pip/serializers/json"
 )
 
 // SerializerOutput is an interface for output plugins that are able to
@@ -38,6 +40,9 @@ type Serializer interface {
 type Config struct {
 	// Dataformat can be one of the serializer types listed in NewSerializer.
 	DataFormat string `toml:"data_format"`
+
+	// Timestamp units to use for JSON formatted output
+	TimestampUnits time.Duration `toml:"json_timestamp_units"`
 }
 
 // NewSerializer a Serializer interface based on the given config.
@@ -49,8 +54,8 @@ func NewSerializer(config *Config) (Serializer, error) {
 	// 	serializer, err = NewInfluxSerializerConfig(config)
 	// case "graphite":
 	// 	serializer, err = NewGraphiteSerializer(config.Prefix, config.Template, config.GraphiteTagSupport, config.GraphiteSeparator, config.Templates)
-	// case "json":
-	// 	serializer, err = NewJsonSerializer(config.TimestampUnits)
+	case "json":
+		serializer, err = NewJsonSerializer(config.TimestampUnits)
 	// case "splunkmetric":
 	// 	serializer, err = NewSplunkmetricSerializer(config.HecRouting, config.SplunkmetricMultiMetric)
 	// case "nowmetric":
@@ -66,3 +71,7 @@ func NewSerializer(config *Config) (Serializer, error) {
 	}
 	return serializer, err
 }
+
+func NewJsonSerializer(timestampUnits time.Duration) (Serializer, error) {
+	return json.NewSerializer(timestampUnits)
+}